@@ -3,7 +3,10 @@ module pz1.2
 go 1.22
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.0
 	github.com/google/uuid v1.5.0
+	golang.org/x/crypto v0.17.0
+	golang.org/x/sync v0.6.0
 	google.golang.org/grpc v1.60.1
 	google.golang.org/protobuf v1.32.0
 )
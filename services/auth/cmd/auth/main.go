@@ -13,9 +13,14 @@ import (
 	authgrpc "pz1.2/services/auth/internal/grpc"
 	authhttp "pz1.2/services/auth/internal/http"
 	"pz1.2/services/auth/internal/service"
+	"pz1.2/services/auth/internal/token"
+	"pz1.2/shared/health"
+	"pz1.2/shared/metrics"
 	"pz1.2/shared/middleware"
 
 	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func main() {
@@ -29,13 +34,41 @@ func main() {
 		grpcPort = "50051"
 	}
 
-	authService := service.NewAuthService()
+	exporter, err := middleware.NewSpanExporter(os.Getenv("TRACES_EXPORTER"), "auth", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	if err != nil {
+		log.Fatalf("Invalid TRACES_EXPORTER: %v", err)
+	}
+	middleware.SetSpanExporter(exporter)
+
+	users, err := newUserStore()
+	if err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+
+	tokens, err := token.NewManager(tokenConfig())
+	if err != nil {
+		log.Fatalf("Failed to init token manager: %v", err)
+	}
+
+	refreshTTL := 30 * 24 * time.Hour
+	if v := os.Getenv("AUTH_REFRESH_TOKEN_TTL"); v != "" {
+		refreshTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid AUTH_REFRESH_TOKEN_TTL: %v", err)
+		}
+	}
+
+	authService := service.NewAuthService(users, tokens, service.NewMemoryRevocationStore(), refreshTTL)
 
 	mux := http.NewServeMux()
 	handler := authhttp.NewHandler(authService)
 	handler.RegisterRoutes(mux)
 
-	httpHandler := middleware.RequestID(middleware.Logging(mux))
+	checker := health.New()
+	checker.RegisterRoutes(mux)
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	httpHandler := middleware.RequestID(middleware.Tracing(mux, middleware.Logging(middleware.Metrics(mux))))
 
 	httpServer := &http.Server{
 		Addr:         ":" + httpPort,
@@ -44,9 +77,16 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middleware.UnaryServerRequestID(), middleware.UnaryServerTracing(), middleware.UnaryServerMetrics()),
+		grpc.StreamInterceptor(middleware.StreamServerRequestID()),
+	)
 	authgrpc.RegisterServer(grpcServer, authService)
 
+	healthServer := grpchealth.NewServer()
+	healthServer.SetServingStatus("auth.AuthService", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
 	go func() {
 		lis, err := net.Listen("tcp", ":"+grpcPort)
 		if err != nil {
@@ -65,12 +105,46 @@ func main() {
 		}
 	}()
 
+	stopRotation := make(chan struct{})
+	if v := os.Getenv("AUTH_KEY_ROTATION_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			log.Fatalf("Invalid AUTH_KEY_ROTATION_INTERVAL: %q", v)
+		}
+		if !tokens.Keys().Rotatable() {
+			log.Fatalf("AUTH_KEY_ROTATION_INTERVAL is set, but %v", token.ErrStaticKey)
+		}
+		log.Printf("Signing keys will be rotated every %s", interval)
+		go tokens.Keys().RunRotation(interval, stopRotation)
+	}
+
+	rotate := make(chan os.Signal, 1)
+	signal.Notify(rotate, syscall.SIGHUP)
+	go func() {
+		for range rotate {
+			log.Println("SIGHUP received, rotating signing key")
+			if err := tokens.Keys().Rotate(); err != nil {
+				log.Printf("Signing key rotation failed: %v", err)
+			}
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Shutting down servers...")
 
+	checker.Shutdown()
+	healthServer.Shutdown()
+	if delay := shutdownDelay(); delay > 0 {
+		log.Printf("Waiting %s for load balancers to drain", delay)
+		time.Sleep(delay)
+	}
+
+	close(stopRotation)
+	signal.Stop(rotate)
+
 	grpcServer.GracefulStop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -78,6 +152,61 @@ func main() {
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Fatalf("HTTP server shutdown failed: %v", err)
 	}
+	if exporter != nil {
+		if err := exporter.Shutdown(ctx); err != nil {
+			log.Printf("Span exporter shutdown failed: %v", err)
+		}
+	}
 
 	log.Println("Servers stopped")
 }
+
+func shutdownDelay() time.Duration {
+	v := os.Getenv("AUTH_SHUTDOWN_DELAY")
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid AUTH_SHUTDOWN_DELAY: %q", v)
+	}
+	return d
+}
+
+func newUserStore() (service.UserStore, error) {
+	if path := os.Getenv("AUTH_USERS_FILE"); path != "" {
+		log.Printf("Loading users from %s", path)
+		return service.NewFileUserStore(path)
+	}
+
+	log.Println("AUTH_USERS_FILE is not set, using in-memory store with default user")
+	store := service.NewMemoryUserStore()
+	if err := store.AddUser("student", "student", service.RoleUser); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func tokenConfig() token.Config {
+	cfg := token.Config{
+		Algorithm:      os.Getenv("AUTH_JWT_ALG"),
+		Issuer:         os.Getenv("AUTH_JWT_ISSUER"),
+		TTL:            15 * time.Minute,
+		Secret:         []byte(os.Getenv("AUTH_JWT_SECRET")),
+		PrivateKeyFile: os.Getenv("AUTH_JWT_PRIVATE_KEY_FILE"),
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = token.AlgHS256
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "pz1.2-auth"
+	}
+	if v := os.Getenv("AUTH_ACCESS_TOKEN_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid AUTH_ACCESS_TOKEN_TTL: %v", err)
+		}
+		cfg.TTL = ttl
+	}
+	return cfg
+}
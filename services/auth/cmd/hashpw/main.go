@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"pz1.2/services/auth/internal/service"
+)
+
+func main() {
+	var password string
+	if len(os.Args) > 1 {
+		password = os.Args[1]
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(os.Stderr, "usage: hashpw <password> (or pass it on stdin)")
+			os.Exit(1)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	hash, err := service.HashPassword(password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(hash)
+}
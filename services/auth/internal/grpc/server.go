@@ -2,10 +2,12 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"log"
 
 	pb "pz1.2/proto/auth"
 	"pz1.2/services/auth/internal/service"
+	"pz1.2/shared/middleware"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -22,24 +24,63 @@ func NewServer(authService *service.AuthService) *Server {
 }
 
 func (s *Server) Verify(ctx context.Context, req *pb.VerifyRequest) (*pb.VerifyResponse, error) {
-	log.Printf("[gRPC] Verify request for token: %s...", truncateToken(req.Token))
+	requestID := middleware.GetRequestID(ctx)
+	log.Printf("[%s] [gRPC] Verify request for token: %s...", requestID, truncateToken(req.Token))
 
 	resp, err := s.authService.Verify(req.Token)
 	if err != nil {
-		log.Printf("[gRPC] Token verification failed: %v", err)
+		log.Printf("[%s] [gRPC] Token verification failed: %v", requestID, err)
 		return &pb.VerifyResponse{
 			Valid: false,
 			Error: "unauthorized",
 		}, status.Error(codes.Unauthenticated, "invalid token")
 	}
 
-	log.Printf("[gRPC] Token verified for subject: %s", resp.Subject)
+	log.Printf("[%s] [gRPC] Token verified for subject: %s", requestID, resp.Subject)
 	return &pb.VerifyResponse{
-		Valid:   resp.Valid,
-		Subject: resp.Subject,
+		Valid:     resp.Valid,
+		Subject:   resp.Subject,
+		Roles:     resp.Roles,
+		Scopes:    resp.Scopes,
+		ExpiresAt: resp.ExpiresAt,
 	}, nil
 }
 
+func (s *Server) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	requestID := middleware.GetRequestID(ctx)
+	log.Printf("[%s] [gRPC] Refresh request", requestID)
+
+	resp, err := s.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		log.Printf("[%s] [gRPC] Refresh failed: %v", requestID, err)
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	log.Printf("[%s] [gRPC] Tokens refreshed", requestID)
+	return &pb.RefreshResponse{
+		AccessToken:  resp.AccessToken,
+		TokenType:    resp.TokenType,
+		ExpiresIn:    resp.ExpiresIn,
+		RefreshToken: resp.RefreshToken,
+	}, nil
+}
+
+func (s *Server) Revoke(ctx context.Context, req *pb.RevokeRequest) (*pb.RevokeResponse, error) {
+	requestID := middleware.GetRequestID(ctx)
+	log.Printf("[%s] [gRPC] Revoke request for token: %s...", requestID, truncateToken(req.Token))
+
+	if err := s.authService.Revoke(req.Token, req.RefreshToken); err != nil {
+		log.Printf("[%s] [gRPC] Revoke failed: %v", requestID, err)
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	log.Printf("[%s] [gRPC] Token revoked", requestID)
+	return &pb.RevokeResponse{Revoked: true}, nil
+}
+
 func truncateToken(token string) string {
 	if len(token) > 10 {
 		return token[:10]
@@ -2,12 +2,14 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
 
 	"pz1.2/services/auth/internal/service"
 	"pz1.2/shared/middleware"
+	"pz1.2/shared/problem"
 )
 
 type Handler struct {
@@ -20,7 +22,10 @@ func NewHandler(authService *service.AuthService) *Handler {
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /v1/auth/login", h.handleLogin)
+	mux.HandleFunc("POST /v1/auth/refresh", h.handleRefresh)
+	mux.HandleFunc("POST /v1/auth/logout", h.handleLogout)
 	mux.HandleFunc("GET /v1/auth/verify", h.handleVerify)
+	mux.HandleFunc("GET /.well-known/jwks.json", h.handleJWKS)
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -29,14 +34,18 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	var req service.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		problem.Error(w, r, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	resp, err := h.authService.Login(req.Username, req.Password)
 	if err != nil {
 		log.Printf("[%s] Login failed: %v", requestID, err)
-		h.respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
+		if !errors.Is(err, service.ErrInvalidCredentials) {
+			problem.Error(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		problem.Error(w, r, http.StatusUnauthorized, "invalid credentials")
 		return
 	}
 
@@ -44,33 +53,73 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, resp)
 }
 
-func (h *Handler) handleVerify(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	requestID := middleware.GetRequestID(r.Context())
-	log.Printf("[%s] Processing verify request", requestID)
+	log.Printf("[%s] Processing refresh request", requestID)
 
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		h.respondJSON(w, http.StatusUnauthorized, service.VerifyResponse{
-			Valid: false,
-			Error: "missing authorization header",
-		})
+	var req service.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		problem.Error(w, r, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		h.respondJSON(w, http.StatusUnauthorized, service.VerifyResponse{
-			Valid: false,
-			Error: "invalid authorization format",
-		})
+	resp, err := h.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		log.Printf("[%s] Refresh failed: %v", requestID, err)
+		if !errors.Is(err, service.ErrInvalidRefreshToken) && !errors.Is(err, service.ErrRefreshTokenReused) {
+			problem.Error(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "invalid refresh token").WithType(problem.TypeInvalidToken))
+		return
+	}
+
+	log.Printf("[%s] Tokens refreshed", requestID)
+	h.respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetRequestID(r.Context())
+	log.Printf("[%s] Processing logout request", requestID)
+
+	token, errMsg := bearerToken(r)
+	if errMsg != "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, errMsg).WithType(problem.TypeInvalidToken))
+		return
+	}
+
+	var req service.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	if err := h.authService.Revoke(token, req.RefreshToken); err != nil {
+		log.Printf("[%s] Logout failed: %v", requestID, err)
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "invalid token").WithType(problem.TypeInvalidToken))
+		return
+	}
+
+	log.Printf("[%s] Token revoked", requestID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleVerify(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetRequestID(r.Context())
+	log.Printf("[%s] Processing verify request", requestID)
+
+	token, errMsg := bearerToken(r)
+	if errMsg != "" {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, errMsg).WithType(problem.TypeInvalidToken))
 		return
 	}
 
-	token := parts[1]
 	resp, err := h.authService.Verify(token)
 	if err != nil {
 		log.Printf("[%s] Token verification failed: %v", requestID, err)
-		h.respondJSON(w, http.StatusUnauthorized, resp)
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "invalid token").WithType(problem.TypeInvalidToken))
 		return
 	}
 
@@ -78,6 +127,25 @@ func (h *Handler) handleVerify(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, resp)
 }
 
+func (h *Handler) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.respondJSON(w, http.StatusOK, h.authService.JWKS())
+}
+
+func bearerToken(r *http.Request) (string, string) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", "missing authorization header"
+	}
+
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return "", "invalid authorization format"
+	}
+
+	return parts[1], ""
+}
+
 func (h *Handler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
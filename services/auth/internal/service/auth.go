@@ -2,22 +2,39 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"pz1.2/services/auth/internal/token"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrInvalidToken       = errors.New("invalid token")
+
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
 )
 
+// dummyHash is compared against when the user does not exist, so that
+// unknown usernames take as long to reject as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
 type AuthService struct {
-	validTokens map[string]string
+	users   UserStore
+	tokens  *token.Manager
+	revoked RevocationStore
+	refresh *refreshStore
 }
 
-func NewAuthService() *AuthService {
+func NewAuthService(users UserStore, tokens *token.Manager, revoked RevocationStore, refreshTTL time.Duration) *AuthService {
 	return &AuthService{
-		validTokens: map[string]string{
-			"demo-token": "student",
-		},
+		users:   users,
+		tokens:  tokens,
+		revoked: revoked,
+		refresh: newRefreshStore(refreshTTL),
 	}
 }
 
@@ -27,35 +44,122 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 type VerifyResponse struct {
-	Valid   bool   `json:"valid"`
-	Subject string `json:"subject,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Valid     bool     `json:"valid"`
+	Subject   string   `json:"subject,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	ExpiresAt int64    `json:"expires_at,omitempty"`
+	Error     string   `json:"error,omitempty"`
 }
 
 func (s *AuthService) Login(username, password string) (*LoginResponse, error) {
-	if username == "student" && password == "student" {
-		return &LoginResponse{
-			AccessToken: "demo-token",
-			TokenType:   "Bearer",
-		}, nil
+	hash := dummyHash
+	user, err := s.users.GetUser(username)
+	if err == nil {
+		hash = []byte(user.PasswordHash)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || user == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.issueTokens(user, "")
+}
+
+// Refresh exchanges a refresh token for a new access/refresh pair. The
+// presented refresh token is spent; reusing it revokes the whole family.
+func (s *AuthService) Refresh(refreshToken string) (*LoginResponse, error) {
+	subject, family, err := s.refresh.use(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-read the user so that role changes apply on the next refresh.
+	user, err := s.users.GetUser(subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefreshToken, err)
+	}
+	return s.issueTokens(user, family)
+}
+
+func (s *AuthService) issueTokens(user *User, family string) (*LoginResponse, error) {
+	roles, scopes := grants(user)
+	accessToken, err := s.tokens.Issue(user.Username, roles, scopes)
+	if err != nil {
+		return nil, err
 	}
-	return nil, ErrInvalidCredentials
+
+	refreshToken, err := s.refresh.issue(user.Username, family)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.tokens.TTL().Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
 }
 
-func (s *AuthService) Verify(token string) (*VerifyResponse, error) {
-	if subject, ok := s.validTokens[token]; ok {
+// Revoke invalidates the access token until its expiry and, if given, the
+// refresh token family it was issued with. An expired access token needs no
+// revocation, but its refresh token family is still revoked.
+func (s *AuthService) Revoke(accessToken, refreshToken string) error {
+	claims, err := s.tokens.Parse(accessToken)
+	if err != nil && !errors.Is(err, token.ErrExpired) {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims != nil {
+		s.revoked.Revoke(claims.ID, time.Until(claims.ExpiresAt.Time))
+	}
+	if refreshToken != "" {
+		s.refresh.revokeFamily(refreshToken)
+	}
+	return nil
+}
+
+func (s *AuthService) JWKS() token.JWKSet {
+	return s.tokens.JWKS()
+}
+
+func (s *AuthService) Verify(accessToken string) (*VerifyResponse, error) {
+	claims, err := s.tokens.Parse(accessToken)
+	if err != nil {
 		return &VerifyResponse{
-			Valid:   true,
-			Subject: subject,
-		}, nil
+			Valid: false,
+			Error: "unauthorized",
+		}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
 	}
+
+	if s.revoked.IsRevoked(claims.ID) {
+		return &VerifyResponse{
+			Valid: false,
+			Error: "unauthorized",
+		}, fmt.Errorf("%w: token %s is revoked", ErrInvalidToken, claims.ID)
+	}
+
 	return &VerifyResponse{
-		Valid: false,
-		Error: "unauthorized",
-	}, ErrInvalidToken
+		Valid:     true,
+		Subject:   claims.Subject,
+		Roles:     claims.Roles,
+		Scopes:    claims.Scopes(),
+		ExpiresAt: claims.ExpiresAt.Unix(),
+	}, nil
 }
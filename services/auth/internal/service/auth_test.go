@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"pz1.2/services/auth/internal/token"
+)
+
+func newTestService(t *testing.T, accessTTL time.Duration) *AuthService {
+	t.Helper()
+	tokens, err := token.NewManager(token.Config{
+		Algorithm: token.AlgHS256,
+		Issuer:    "test",
+		TTL:       accessTTL,
+		Secret:    []byte("0123456789abcdef0123456789abcdef"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewMemoryUserStore()
+	if err := users.AddUser("student", "student", RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthService(users, tokens, NewMemoryRevocationStore(), time.Hour)
+}
+
+func TestLogoutWithExpiredAccessTokenRevokesRefreshFamily(t *testing.T) {
+	s := newTestService(t, -time.Minute)
+
+	resp, err := s.Login("student", "student")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Verify(resp.AccessToken); err == nil {
+		t.Fatal("Verify accepted an expired access token")
+	}
+
+	if err := s.Revoke(resp.AccessToken, resp.RefreshToken); err != nil {
+		t.Fatalf("Revoke with an expired access token: %v", err)
+	}
+	if _, err := s.Refresh(resp.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh after logout = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestLogoutWithInvalidAccessTokenKeepsRefreshFamily(t *testing.T) {
+	s := newTestService(t, time.Minute)
+
+	resp, err := s.Login("student", "student")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Revoke("not-a-token", resp.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Revoke with a malformed token = %v, want ErrInvalidToken", err)
+	}
+	if _, err := s.Refresh(resp.RefreshToken); err != nil {
+		t.Fatalf("Refresh after a rejected logout: %v", err)
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	s := newTestService(t, time.Minute)
+
+	resp, err := s.Login("student", "student")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(resp.AccessToken, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Verify(resp.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify after logout = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const refreshPruneInterval = time.Minute
+
+type refreshEntry struct {
+	subject   string
+	family    string
+	expiresAt time.Time
+	used      bool
+}
+
+type refreshFamily struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// refreshStore keeps refresh tokens by their SHA-256 hash, grouped into
+// families: every token obtained by rotation belongs to the family of the
+// token it replaced.
+type refreshStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	tokens    map[string]*refreshEntry
+	families  map[string]*refreshFamily
+	lastPrune time.Time
+}
+
+func newRefreshStore(ttl time.Duration) *refreshStore {
+	return &refreshStore{
+		ttl:       ttl,
+		tokens:    make(map[string]*refreshEntry),
+		families:  make(map[string]*refreshFamily),
+		lastPrune: time.Now(),
+	}
+}
+
+// issue creates a refresh token for subject. An empty family starts a new one.
+func (s *refreshStore) issue(subject, family string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	expiresAt := now.Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if family == "" {
+		family = uuid.New().String()
+	}
+	fam, ok := s.families[family]
+	if !ok {
+		fam = &refreshFamily{}
+		s.families[family] = fam
+	}
+	fam.expiresAt = expiresAt
+
+	s.tokens[hashRefreshToken(token)] = &refreshEntry{
+		subject:   subject,
+		family:    family,
+		expiresAt: expiresAt,
+	}
+
+	if now.Sub(s.lastPrune) > refreshPruneInterval {
+		s.pruneLocked(now)
+	}
+
+	return token, nil
+}
+
+// use marks the token as spent and returns its subject and family.
+// Presenting an already used token revokes its whole family.
+func (s *refreshStore) use(token string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.tokens[hashRefreshToken(token)]
+	if !ok {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	fam := s.families[entry.family]
+	if fam == nil || fam.revoked {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	if entry.used {
+		fam.revoked = true
+		return "", "", ErrRefreshTokenReused
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	entry.used = true
+	return entry.subject, entry.family, nil
+}
+
+// revokeFamily revokes the family of the given token, if it is known.
+func (s *refreshStore) revokeFamily(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.tokens[hashRefreshToken(token)]
+	if !ok {
+		return
+	}
+	if fam := s.families[entry.family]; fam != nil {
+		fam.revoked = true
+	}
+}
+
+func (s *refreshStore) pruneLocked(now time.Time) {
+	for hash, entry := range s.tokens {
+		if now.After(entry.expiresAt) {
+			delete(s.tokens, hash)
+		}
+	}
+	for id, fam := range s.families {
+		if now.After(fam.expiresAt) {
+			delete(s.families, id)
+		}
+	}
+	s.lastPrune = now
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
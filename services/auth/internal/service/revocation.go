@@ -0,0 +1,58 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+const revocationPruneInterval = time.Minute
+
+type RevocationStore interface {
+	Revoke(jti string, ttl time.Duration)
+	IsRevoked(jti string) bool
+}
+
+// MemoryRevocationStore keeps revoked token IDs until the tokens would have
+// expired anyway.
+type MemoryRevocationStore struct {
+	mu        sync.RWMutex
+	revoked   map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked:   make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[jti] = now.Add(ttl)
+
+	if now.Sub(s.lastPrune) > revocationPruneInterval {
+		for id, expiresAt := range s.revoked {
+			if now.After(expiresAt) {
+				delete(s.revoked, id)
+			}
+		}
+		s.lastPrune = now
+	}
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiresAt, ok := s.revoked[jti]
+	return ok && time.Now().Before(expiresAt)
+}
@@ -0,0 +1,46 @@
+package service
+
+import "sort"
+
+const (
+	RoleAdmin  = "admin"
+	RoleUser   = "user"
+	RoleViewer = "viewer"
+
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+	ScopeTasksAdmin = "tasks:admin"
+)
+
+var roleScopes = map[string][]string{
+	RoleAdmin:  {ScopeTasksRead, ScopeTasksWrite, ScopeTasksAdmin},
+	RoleUser:   {ScopeTasksRead, ScopeTasksWrite},
+	RoleViewer: {ScopeTasksRead},
+}
+
+// grants returns the user's roles (RoleUser if none are set) and the union
+// of the scopes granted by those roles and assigned to the user directly.
+func grants(user *User) ([]string, []string) {
+	roles := user.Roles
+	if len(roles) == 0 {
+		roles = []string{RoleUser}
+	}
+
+	set := make(map[string]struct{})
+	for _, role := range roles {
+		for _, scope := range roleScopes[role] {
+			set[scope] = struct{}{}
+		}
+	}
+	for _, scope := range user.Scopes {
+		set[scope] = struct{}{}
+	}
+
+	scopes := make([]string, 0, len(set))
+	for scope := range set {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	return roles, scopes
+}
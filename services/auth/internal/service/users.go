@@ -0,0 +1,135 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+)
+
+type User struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"password_hash"`
+	Roles        []string `json:"roles,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+type UserStore interface {
+	GetUser(username string) (*User, error)
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users: make(map[string]*User),
+	}
+}
+
+func (s *MemoryUserStore) AddUser(username, password string, roles ...string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[username]; ok {
+		return ErrUserExists
+	}
+
+	s.users[username] = &User{
+		Username:     username,
+		PasswordHash: hash,
+		Roles:        roles,
+	}
+	return nil
+}
+
+func (s *MemoryUserStore) GetUser(username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// FileUserStore reads users from a JSON file with pre-hashed passwords:
+// [{"username": "alice", "password_hash": "$2a$10$...", "roles": ["admin"]}]
+type FileUserStore struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+func NewFileUserStore(path string) (*FileUserStore, error) {
+	s := &FileUserStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileUserStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read users file: %w", err)
+	}
+
+	var list []User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decode users file: %w", err)
+	}
+
+	users := make(map[string]*User, len(list))
+	for i := range list {
+		user := list[i]
+		if user.Username == "" || user.PasswordHash == "" {
+			return fmt.Errorf("users file: entry %d: username and password_hash are required", i)
+		}
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			return fmt.Errorf("users file: user %s: invalid password hash: %w", user.Username, err)
+		}
+		users[user.Username] = &user
+	}
+
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FileUserStore) GetUser(username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
@@ -0,0 +1,67 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+)
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// publicJWK describes a verification key. Symmetric keys are never published.
+func publicJWK(alg string, key interface{}) (JWK, bool) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: alg,
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Alg: alg,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// keyID derives a stable kid: the RFC 7638 thumbprint for public keys and a
+// truncated hash for symmetric secrets.
+func keyID(alg string, verifyKey interface{}) string {
+	var data []byte
+	switch k := verifyKey.(type) {
+	case []byte:
+		sum := sha256.Sum256(k)
+		return "hs-" + base64.RawURLEncoding.EncodeToString(sum[:8])
+	case *rsa.PublicKey:
+		jwk, _ := publicJWK(alg, k)
+		data, _ = json.Marshal(map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N})
+	case ed25519.PublicKey:
+		jwk, _ := publicJWK(alg, k)
+		data, _ = json.Marshal(map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X})
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,134 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrMissingClaims = errors.New("token is missing sub or jti")
+	ErrUnknownKey    = errors.New("token is signed with an unknown key")
+	// ErrExpired is matched by Parse errors for tokens that are signed
+	// correctly but past their expiry.
+	ErrExpired = jwt.ErrTokenExpired
+)
+
+type Config struct {
+	Algorithm      string
+	Issuer         string
+	TTL            time.Duration
+	Secret         []byte
+	PrivateKeyFile string
+}
+
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+	Scope string   `json:"scope,omitempty"`
+}
+
+// Scopes splits the space-delimited scope claim.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+type Manager struct {
+	method jwt.SigningMethod
+	keys   *KeyManager
+	issuer string
+	ttl    time.Duration
+}
+
+func NewManager(cfg Config) (*Manager, error) {
+	method := jwt.GetSigningMethod(cfg.Algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm: %q", cfg.Algorithm)
+	}
+
+	keys, err := NewKeyManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		method: method,
+		keys:   keys,
+		issuer: cfg.Issuer,
+		ttl:    cfg.TTL,
+	}, nil
+}
+
+func (m *Manager) TTL() time.Duration {
+	return m.ttl
+}
+
+func (m *Manager) Keys() *KeyManager {
+	return m.keys
+}
+
+func (m *Manager) Issue(subject string, roles, scopes []string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+			ID:        uuid.New().String(),
+		},
+		Roles: roles,
+		Scope: strings.Join(scopes, " "),
+	}
+
+	kid, key := m.keys.signing()
+	t := jwt.NewWithClaims(m.method, claims)
+	t.Header["kid"] = kid
+
+	signed, err := t.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+	return signed, nil
+}
+
+func (m *Manager) Parse(tokenString string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, m.keyFunc,
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" || claims.ID == "" {
+		return nil, ErrMissingClaims
+	}
+	return &claims, nil
+}
+
+func (m *Manager) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := m.keys.verificationKey(kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// JWKS returns the public verification keys. It is empty for HS256.
+func (m *Manager) JWKS() JWKSet {
+	return m.keys.JWKS()
+}
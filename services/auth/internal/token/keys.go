@@ -0,0 +1,266 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrStaticKey is returned by Rotate when the signing key comes from
+// configuration: a generated replacement would not survive a restart and
+// would not be shared with other instances.
+var ErrStaticKey = errors.New("signing key is configured (AUTH_JWT_SECRET or AUTH_JWT_PRIVATE_KEY_FILE) and cannot be rotated")
+
+type signingKey struct {
+	kid       string
+	signKey   interface{}
+	verifyKey interface{}
+	retiredAt time.Time
+}
+
+// KeyManager holds the active signing key and the keys it replaced. A
+// retired key stays available for verification for the overlap period,
+// i.e. until the last token signed with it has expired. The key that will
+// become active on the next rotation is published in advance, so that
+// JWKS caches already know it when the first token signed with it arrives.
+// Only generated keys are rotated; a configured key is never replaced.
+type KeyManager struct {
+	alg     string
+	overlap time.Duration
+	static  bool
+
+	mu       sync.RWMutex
+	active   *signingKey
+	next     *signingKey
+	previous []*signingKey
+}
+
+func NewKeyManager(cfg Config) (*KeyManager, error) {
+	km := &KeyManager{
+		alg:     cfg.Algorithm,
+		overlap: cfg.TTL,
+	}
+
+	var (
+		key *signingKey
+		err error
+	)
+	switch cfg.Algorithm {
+	case AlgHS256:
+		if len(cfg.Secret) == 0 {
+			log.Println("JWT secret is not set, generating a random one (tokens will not survive restart)")
+			key, err = km.generate()
+		} else {
+			key = newSigningKey(cfg.Algorithm, cfg.Secret, cfg.Secret)
+			km.static = true
+		}
+	case AlgRS256, AlgEdDSA:
+		if cfg.PrivateKeyFile == "" {
+			log.Printf("JWT private key file is not set, generating an ephemeral %s key", cfg.Algorithm)
+			key, err = km.generate()
+		} else {
+			var signer crypto.Signer
+			signer, err = loadPrivateKey(cfg.Algorithm, cfg.PrivateKeyFile)
+			if err == nil {
+				key = newSigningKey(cfg.Algorithm, signer, signer.Public())
+				km.static = true
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %q", cfg.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	km.active = key
+
+	if !km.static {
+		if km.next, err = km.generate(); err != nil {
+			return nil, err
+		}
+	}
+	return km, nil
+}
+
+// Rotatable reports whether Rotate can replace the signing key.
+func (km *KeyManager) Rotatable() bool {
+	return !km.static
+}
+
+// Rotate activates the pre-published next key, retires the current one and
+// generates a new next key. It returns ErrStaticKey for a configured key.
+func (km *KeyManager) Rotate() error {
+	if km.static {
+		return ErrStaticKey
+	}
+
+	next, err := km.generate()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	km.active.retiredAt = now
+	km.previous = append(km.previous, km.active)
+	km.active = km.next
+	km.next = next
+	km.pruneLocked(now)
+
+	log.Printf("Signing key rotated: active kid=%s, %d previous keys still valid", km.active.kid, len(km.previous))
+	return nil
+}
+
+// RunRotation rotates keys every interval until stop is closed.
+func (km *KeyManager) RunRotation(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := km.Rotate(); err != nil {
+				log.Printf("Signing key rotation failed: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (km *KeyManager) signing() (string, interface{}) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.active.kid, km.active.signKey
+}
+
+func (km *KeyManager) verificationKey(kid string) (interface{}, bool) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	for _, key := range km.validLocked(time.Now()) {
+		if key.kid == kid {
+			return key.verifyKey, true
+		}
+	}
+	return nil, false
+}
+
+// JWKS returns the public keys of the active, next and still valid previous
+// keys. It is empty for HS256.
+func (km *KeyManager) JWKS() JWKSet {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	keys := km.validLocked(time.Now())
+	if km.next != nil {
+		keys = append(keys, km.next)
+	}
+	for _, key := range keys {
+		if jwk, ok := publicJWK(km.alg, key.verifyKey); ok {
+			jwk.Kid = key.kid
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (km *KeyManager) validLocked(now time.Time) []*signingKey {
+	keys := []*signingKey{km.active}
+	for i := len(km.previous) - 1; i >= 0; i-- {
+		if now.Sub(km.previous[i].retiredAt) <= km.overlap {
+			keys = append(keys, km.previous[i])
+		}
+	}
+	return keys
+}
+
+func (km *KeyManager) pruneLocked(now time.Time) {
+	kept := km.previous[:0]
+	for _, key := range km.previous {
+		if now.Sub(key.retiredAt) <= km.overlap {
+			kept = append(kept, key)
+		}
+	}
+	km.previous = kept
+}
+
+func (km *KeyManager) generate() (*signingKey, error) {
+	switch km.alg {
+	case AlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("generate secret: %w", err)
+		}
+		return newSigningKey(km.alg, secret, secret), nil
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("generate RSA key: %w", err)
+		}
+		return newSigningKey(km.alg, key, key.Public()), nil
+	case AlgEdDSA:
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generate Ed25519 key: %w", err)
+		}
+		return newSigningKey(km.alg, key, pub), nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm: %q", km.alg)
+}
+
+func newSigningKey(alg string, signKey, verifyKey interface{}) *signingKey {
+	return &signingKey{
+		kid:       keyID(alg, verifyKey),
+		signKey:   signKey,
+		verifyKey: verifyKey,
+	}
+}
+
+func loadPrivateKey(alg, path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("private key %s: no PEM data", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if alg == AlgRS256 {
+			return key, nil
+		}
+	case ed25519.PrivateKey:
+		if alg == AlgEdDSA {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("private key %s does not match algorithm %s", path, alg)
+}
@@ -2,17 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"pz1.2/services/tasks/internal/client/authclient"
+	tasksgrpc "pz1.2/services/tasks/internal/grpc"
 	taskshttp "pz1.2/services/tasks/internal/http"
+	"pz1.2/services/tasks/internal/idempotency"
 	"pz1.2/services/tasks/internal/service"
+	"pz1.2/services/tasks/internal/storage"
+	"pz1.2/services/tasks/internal/webhook"
+	"pz1.2/shared/health"
+	"pz1.2/shared/metrics"
 	"pz1.2/shared/middleware"
+
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -21,6 +33,17 @@ func main() {
 		port = "8082"
 	}
 
+	grpcPort := os.Getenv("TASKS_GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "50052"
+	}
+
+	exporter, err := middleware.NewSpanExporter(os.Getenv("TRACES_EXPORTER"), "tasks", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	if err != nil {
+		log.Fatalf("Invalid TRACES_EXPORTER: %v", err)
+	}
+	middleware.SetSpanExporter(exporter)
+
 	authMode := os.Getenv("AUTH_MODE")
 	if authMode == "" {
 		authMode = "http"
@@ -30,33 +53,124 @@ func main() {
 
 	switch authMode {
 	case "grpc":
-		grpcAddr := os.Getenv("AUTH_GRPC_ADDR")
-		if grpcAddr == "" {
-			grpcAddr = "localhost:50051"
+		client := newGRPCVerifier()
+		defer client.Close()
+		authVerifier = authclient.NewInstrumentedVerifier("grpc", client)
+	case "failover":
+		grpcClient := newGRPCVerifier()
+		defer grpcClient.Close()
+		httpClient := newHTTPVerifier()
+
+		cfg := authclient.FailoverConfig{
+			PrimaryName:   "grpc",
+			SecondaryName: "http",
+			ProbeInterval: envDuration("AUTH_FAILOVER_PROBE_INTERVAL", 5*time.Second),
+			ProbeTimeout:  2 * time.Second,
+		}
+		if cfg.ProbeInterval <= 0 {
+			log.Fatalf("Invalid AUTH_FAILOVER_PROBE_INTERVAL: %q, must be positive", os.Getenv("AUTH_FAILOVER_PROBE_INTERVAL"))
+		}
+		var primary, secondary authclient.AuthVerifier = authclient.NewInstrumentedVerifier("grpc", grpcClient),
+			authclient.NewInstrumentedVerifier("http", httpClient)
+		switch os.Getenv("AUTH_FAILOVER_PRIMARY") {
+		case "", "grpc":
+		case "http":
+			primary, secondary = secondary, primary
+			cfg.PrimaryName, cfg.SecondaryName = cfg.SecondaryName, cfg.PrimaryName
+		default:
+			log.Fatalf("Invalid AUTH_FAILOVER_PRIMARY: %q", os.Getenv("AUTH_FAILOVER_PRIMARY"))
+		}
+		log.Printf("Using %s auth client with failover to %s", cfg.PrimaryName, cfg.SecondaryName)
+
+		failover := authclient.NewFailoverVerifier(primary, secondary, cfg)
+		defer failover.Close()
+		authclient.RegisterFailoverMetrics(failover)
+		authVerifier = failover
+	case "jwks":
+		jwksURL := os.Getenv("AUTH_JWKS_URL")
+		if jwksURL == "" {
+			// Keys are fetched from the first auth instance only; replicas
+			// must share their key material for this to cover all tokens.
+			requireSharedKey("AUTH_BASE_URL", authBaseURL())
+			baseURL, _, _ := strings.Cut(authBaseURL(), ",")
+			if strings.HasPrefix(baseURL, "dns:///") {
+				baseURL = "http://" + strings.TrimPrefix(baseURL, "dns:///")
+			}
+			jwksURL = strings.TrimRight(baseURL, "/") + "/.well-known/jwks.json"
+		}
+		issuer := os.Getenv("AUTH_JWT_ISSUER")
+		if issuer == "" {
+			issuer = "pz1.2-auth"
+		}
+		log.Printf("Using local JWKS token verification, keys from %s", jwksURL)
+		jwks := authclient.NewJWKSVerifier(jwksURL, issuer, 3*time.Second)
+		loadCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := jwks.Load(loadCtx)
+		cancel()
+		if errors.Is(err, authclient.ErrNoUsableKeys) {
+			log.Fatalf("AUTH_MODE=jwks needs auth to sign with AUTH_JWT_ALG=RS256 or EdDSA: %v", err)
 		}
-		log.Printf("Using gRPC auth client, connecting to %s", grpcAddr)
-		client, err := authclient.NewGRPCClient(grpcAddr, 2*time.Second)
 		if err != nil {
-			log.Fatalf("Failed to create gRPC auth client: %v", err)
+			log.Fatalf("Cannot load JWKS from %s: %v", jwksURL, err)
 		}
-		authVerifier = client
-		defer client.Close()
+		authVerifier = authclient.NewInstrumentedVerifier("jwks", jwks)
 	default:
-		authBaseURL := os.Getenv("AUTH_BASE_URL")
-		if authBaseURL == "" {
-			authBaseURL = "http://localhost:8081"
-		}
-		log.Printf("Using HTTP auth client, connecting to %s", authBaseURL)
-		authVerifier = authclient.NewHTTPClient(authBaseURL, 3*time.Second)
+		authVerifier = authclient.NewInstrumentedVerifier("http", newHTTPVerifier())
 	}
 
-	taskService := service.NewTaskService()
+	// Readiness pings auth through the verifier itself, not through the
+	// breaker and cache, which would hide an outage.
+	checker := health.New()
+	pingVerifier := authVerifier
+	checker.AddCheck("auth", func(ctx context.Context) error {
+		return authclient.Ping(ctx, pingVerifier)
+	})
+
+	var breaker *authclient.CircuitBreakerVerifier
+	if cfg := breakerConfig(); cfg.FailureThreshold > 0 {
+		log.Printf("Auth circuit breaker: opens after %d failures for %s, %d retries", cfg.FailureThreshold, cfg.OpenTimeout, cfg.MaxRetries)
+		breaker = authclient.NewCircuitBreakerVerifier(authVerifier, cfg)
+		authclient.RegisterBreakerMetrics(breaker)
+		authVerifier = breaker
+	}
+
+	var cache *authclient.CachingVerifier
+	if cfg := cacheConfig(); cfg.Size > 0 {
+		log.Printf("Caching token verification: size=%d ttl=%s negative_ttl=%s", cfg.Size, cfg.TTL, cfg.NegativeTTL)
+		cache = authclient.NewCachingVerifier(authVerifier, cfg)
+		authclient.RegisterCacheMetrics(cache)
+		authVerifier = cache
+	}
+
+	repo, closeRepo := newTaskRepository()
+	defer closeRepo()
+
+	taskService, err := service.NewTaskService(repo)
+	if err != nil {
+		log.Fatalf("Failed to load tasks: %v", err)
+	}
 
 	mux := http.NewServeMux()
-	handler := taskshttp.NewHandler(taskService, authVerifier)
+	idempotencyTTL := 24 * time.Hour
+	if v := os.Getenv("TASKS_IDEMPOTENCY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid TASKS_IDEMPOTENCY_TTL: %v", err)
+		}
+		idempotencyTTL = ttl
+	}
+
+	webhooks := webhook.NewStore()
+	webhookCfg := webhookConfig()
+	dispatcher := webhook.NewDispatcher(taskService, webhooks, webhookCfg)
+	go dispatcher.Run()
+
+	handler := taskshttp.NewHandler(taskService, authVerifier, idempotency.NewStore(idempotencyTTL), webhooks, webhookCfg.Destinations)
 	handler.RegisterRoutes(mux)
+	checker.RegisterRoutes(mux)
+	mux.Handle("GET /metrics", metrics.Handler())
 
-	httpHandler := middleware.RequestID(middleware.Logging(mux))
+	httpHandler := middleware.RequestID(middleware.Tracing(mux, middleware.Logging(middleware.Metrics(mux))))
 
 	server := &http.Server{
 		Addr:         ":" + port,
@@ -65,6 +179,32 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			middleware.UnaryServerRequestID(),
+			middleware.UnaryServerTracing(),
+			middleware.UnaryServerMetrics(),
+			tasksgrpc.AuthInterceptor(authVerifier),
+		),
+		grpc.ChainStreamInterceptor(
+			middleware.StreamServerRequestID(),
+			middleware.StreamServerTracing(),
+			tasksgrpc.AuthStreamInterceptor(authVerifier),
+		),
+	)
+	tasksgrpc.RegisterServer(grpcServer, taskService)
+
+	go func() {
+		lis, err := net.Listen("tcp", ":"+grpcPort)
+		if err != nil {
+			log.Fatalf("Failed to listen on gRPC port %s: %v", grpcPort, err)
+		}
+		log.Printf("Tasks gRPC server starting on :%s", grpcPort)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("gRPC server failed: %v", err)
+		}
+	}()
+
 	go func() {
 		log.Printf("Tasks HTTP server starting on :%s", port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -76,13 +216,203 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	log.Println("Shutting down servers...")
+
+	checker.Shutdown()
+	if delay := envDuration("TASKS_SHUTDOWN_DELAY", 0); delay > 0 {
+		log.Printf("Waiting %s for load balancers to drain", delay)
+		time.Sleep(delay)
+	}
+
+	// End event streams, or they would hold both servers open.
+	dispatcher.Stop()
+	taskService.StopWatchers()
+
+	grpcServer.GracefulStop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server shutdown failed: %v", err)
 	}
+	if exporter != nil {
+		if err := exporter.Shutdown(ctx); err != nil {
+			log.Printf("Span exporter shutdown failed: %v", err)
+		}
+	}
+
+	if breaker != nil {
+		stats := breaker.Stats()
+		log.Printf("Auth circuit breaker: state %s, opened %d times, %d rejected, %d retries, %d failures, %d successes",
+			stats.State, stats.Opened, stats.Rejected, stats.Retries, stats.Failures, stats.Successes)
+	}
+	if cache != nil {
+		stats := cache.Stats()
+		log.Printf("Token cache: %d hits, %d misses, %d entries", stats.Hits, stats.Misses, stats.Size)
+	}
+
+	log.Println("Servers stopped")
+}
+
+func authBaseURL() string {
+	if v := os.Getenv("AUTH_BASE_URL"); v != "" {
+		return v
+	}
+	return "http://localhost:8081"
+}
+
+// requireSharedKey refuses to start when target names several auth
+// instances and AUTH_SHARED_KEY does not confirm that they sign with the
+// same key. Otherwise each instance generates its own key at startup and
+// tokens issued by one are rejected by the others. Revocation and refresh
+// tokens stay per instance either way.
+func requireSharedKey(name, target string) {
+	if !strings.Contains(target, ",") && !strings.HasPrefix(target, "dns:///") {
+		return
+	}
+	if !envBool("AUTH_SHARED_KEY", false) {
+		log.Fatalf("%s lists several auth instances; give them the same AUTH_JWT_SECRET or AUTH_JWT_PRIVATE_KEY_FILE and set AUTH_SHARED_KEY=true", name)
+	}
+	log.Printf("%s lists several auth instances; token revocation and refresh tokens are not shared between them", name)
+}
+
+func newHTTPVerifier() *authclient.HTTPClient {
+	baseURL := authBaseURL()
+	log.Printf("Using HTTP auth client, connecting to %s", baseURL)
+	requireSharedKey("AUTH_BASE_URL", baseURL)
+	client, err := authclient.NewHTTPClient(baseURL, 3*time.Second)
+	if err != nil {
+		log.Fatalf("Failed to create HTTP auth client: %v", err)
+	}
+	return client
+}
+
+func newGRPCVerifier() *authclient.GRPCClient {
+	grpcAddr := os.Getenv("AUTH_GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = "localhost:50051"
+	}
+	log.Printf("Using gRPC auth client, connecting to %s", grpcAddr)
+	requireSharedKey("AUTH_GRPC_ADDR", grpcAddr)
+	client, err := authclient.NewGRPCClient(grpcAddr, 2*time.Second)
+	if err != nil {
+		log.Fatalf("Failed to create gRPC auth client: %v", err)
+	}
+	return client
+}
+
+func newTaskRepository() (service.TaskRepository, func()) {
+	switch os.Getenv("TASKS_STORAGE") {
+	case "file":
+		dir := os.Getenv("TASKS_DATA_DIR")
+		if dir == "" {
+			dir = "./data"
+		}
+		snapshotEvery := 1000
+		if v := os.Getenv("TASKS_SNAPSHOT_EVERY"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				log.Fatalf("Invalid TASKS_SNAPSHOT_EVERY: %v", err)
+			}
+			snapshotEvery = n
+		}
+		log.Printf("Using file task storage in %s", dir)
+		repo, err := storage.NewFileRepository(dir, snapshotEvery)
+		if err != nil {
+			log.Fatalf("Failed to open task storage: %v", err)
+		}
+		return repo, func() {
+			if err := repo.Close(); err != nil {
+				log.Printf("Failed to close task storage: %v", err)
+			}
+		}
+	default:
+		log.Println("Using in-memory task storage")
+		return storage.NewMemoryRepository(), func() {}
+	}
+}
+
+func breakerConfig() authclient.BreakerConfig {
+	return authclient.BreakerConfig{
+		FailureThreshold: envInt("AUTH_BREAKER_FAILURES", 5),
+		OpenTimeout:      envDuration("AUTH_BREAKER_OPEN_TIMEOUT", 10*time.Second),
+		HalfOpenRequests: envInt("AUTH_BREAKER_HALF_OPEN_REQUESTS", 1),
+		MaxRetries:       envInt("AUTH_RETRY_MAX", 2),
+		RetryBase:        envDuration("AUTH_RETRY_BASE", 50*time.Millisecond),
+		RetryMaxDelay:    envDuration("AUTH_RETRY_MAX_DELAY", time.Second),
+	}
+}
+
+func cacheConfig() authclient.CacheConfig {
+	cfg := authclient.CacheConfig{
+		Size:        envInt("AUTH_CACHE_SIZE", 0),
+		TTL:         envDuration("AUTH_CACHE_TTL", 30*time.Second),
+		NegativeTTL: envDuration("AUTH_CACHE_NEGATIVE_TTL", 5*time.Second),
+	}
+	if cfg.Size > 0 && cfg.NegativeTTL >= cfg.TTL {
+		log.Fatalf("Invalid token cache configuration: AUTH_CACHE_NEGATIVE_TTL (%s) must be shorter than AUTH_CACHE_TTL (%s)", cfg.NegativeTTL, cfg.TTL)
+	}
+	return cfg
+}
+
+func webhookConfig() webhook.Config {
+	cfg := webhook.Config{
+		MaxAttempts: envInt("TASKS_WEBHOOK_MAX_ATTEMPTS", 6),
+		RetryBase:   envDuration("TASKS_WEBHOOK_RETRY_BASE", time.Second),
+		Timeout:     envDuration("TASKS_WEBHOOK_TIMEOUT", 5*time.Second),
+		QueueSize:   envInt("TASKS_WEBHOOK_QUEUE_SIZE", 1000),
+	}
+	if cfg.MaxAttempts < 1 || cfg.RetryBase <= 0 || cfg.Timeout <= 0 || cfg.QueueSize < 1 {
+		log.Fatalf("Invalid webhook configuration: %+v", cfg)
+	}
 
-	log.Println("Server stopped")
+	var allowed []string
+	if v := os.Getenv("TASKS_WEBHOOK_ALLOWED_HOSTS"); v != "" {
+		allowed = strings.Split(v, ",")
+	}
+	destinations, err := webhook.NewDestinations(allowed)
+	if err != nil {
+		log.Fatalf("Invalid TASKS_WEBHOOK_ALLOWED_HOSTS: %v", err)
+	}
+	cfg.Destinations = destinations
+	return cfg
+}
+
+// envInt reads a non-negative integer from the environment.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s: %q", name, v)
+	}
+	return n
+}
+
+// envBool reads a boolean from the environment.
+func envBool(name string, def bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("Invalid %s: %q", name, v)
+	}
+	return b
+}
+
+// envDuration reads a non-negative duration from the environment.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid %s: %q", name, v)
+	}
+	return d
 }
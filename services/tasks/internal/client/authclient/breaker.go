@@ -0,0 +1,226 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pz1.2/shared/middleware"
+)
+
+var ErrCircuitOpen = errors.New("auth circuit breaker is open")
+
+type BreakerState int32
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed verifications
+	// that opens the circuit.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before letting trial
+	// requests through.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is how many trial requests may run at once while
+	// half-open. One success closes the circuit, one failure opens it again.
+	HalfOpenRequests int
+
+	// MaxRetries bounds the retries of transient errors per verification.
+	MaxRetries int
+	// RetryBase and RetryMaxDelay bound the jittered exponential backoff.
+	RetryBase     time.Duration
+	RetryMaxDelay time.Duration
+}
+
+type BreakerStats struct {
+	State     string `json:"state"`
+	Opened    uint64 `json:"opened"`
+	Rejected  uint64 `json:"rejected"`
+	Retries   uint64 `json:"retries"`
+	Failures  uint64 `json:"failures"`
+	Successes uint64 `json:"successes"`
+}
+
+// CircuitBreakerVerifier fails fast with ErrCircuitOpen while the auth
+// service keeps failing, instead of waiting for a timeout on every request.
+// While closed it retries transient errors with jittered backoff.
+type CircuitBreakerVerifier struct {
+	next AuthVerifier
+	cfg  BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trials   int
+
+	opened    atomic.Uint64
+	rejected  atomic.Uint64
+	retries   atomic.Uint64
+	failed    atomic.Uint64
+	succeeded atomic.Uint64
+}
+
+func NewCircuitBreakerVerifier(next AuthVerifier, cfg BreakerConfig) *CircuitBreakerVerifier {
+	if cfg.HalfOpenRequests < 1 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &CircuitBreakerVerifier{next: next, cfg: cfg}
+}
+
+func (b *CircuitBreakerVerifier) Verify(ctx context.Context, token string) (*VerifyResponse, error) {
+	state, ok := b.acquire()
+	if !ok {
+		b.rejected.Add(1)
+		return nil, ErrCircuitOpen
+	}
+
+	var resp *VerifyResponse
+	var err error
+	if state == StateHalfOpen {
+		resp, err = b.next.Verify(ctx, token)
+	} else {
+		resp, err = b.verifyWithRetries(ctx, token)
+	}
+
+	b.release(state, err == nil)
+	return resp, err
+}
+
+func (b *CircuitBreakerVerifier) verifyWithRetries(ctx context.Context, token string) (*VerifyResponse, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := b.next.Verify(ctx, token)
+		if err == nil || attempt >= b.cfg.MaxRetries || !IsTransient(err) {
+			return resp, err
+		}
+
+		delay := b.backoff(attempt)
+		log.Printf("[%s] Auth verify failed (%v), retry %d/%d in %s",
+			middleware.GetRequestID(ctx), err, attempt+1, b.cfg.MaxRetries, delay)
+		b.retries.Add(1)
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns a random delay up to RetryBase*2^attempt ("full jitter"),
+// capped at RetryMaxDelay.
+func (b *CircuitBreakerVerifier) backoff(attempt int) time.Duration {
+	ceiling := b.cfg.RetryBase << attempt
+	if ceiling <= 0 || ceiling > b.cfg.RetryMaxDelay {
+		ceiling = b.cfg.RetryMaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// acquire decides whether a call may go through and in which state.
+func (b *CircuitBreakerVerifier) acquire() (BreakerState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		if time.Since(b.openedAt) < b.cfg.OpenTimeout {
+			return StateOpen, false
+		}
+		b.setState(StateHalfOpen)
+	}
+
+	if b.state == StateHalfOpen {
+		if b.trials >= b.cfg.HalfOpenRequests {
+			return StateHalfOpen, false
+		}
+		b.trials++
+	}
+	return b.state, true
+}
+
+func (b *CircuitBreakerVerifier) release(state BreakerState, success bool) {
+	if success {
+		b.succeeded.Add(1)
+	} else {
+		b.failed.Add(1)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if state == StateHalfOpen {
+		b.trials--
+	}
+	// A call that started in an earlier state must not override the
+	// outcome of the trial requests.
+	if state != b.state {
+		return
+	}
+
+	switch {
+	case success:
+		b.failures = 0
+		if b.state == StateHalfOpen {
+			b.setState(StateClosed)
+		}
+	case b.state == StateHalfOpen:
+		b.setState(StateOpen)
+	default:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(StateOpen)
+		}
+	}
+}
+
+func (b *CircuitBreakerVerifier) setState(state BreakerState) {
+	log.Printf("Auth circuit breaker: %s -> %s", b.state, state)
+	b.state = state
+	switch state {
+	case StateOpen:
+		b.openedAt = time.Now()
+		b.opened.Add(1)
+	case StateClosed:
+		b.failures = 0
+	}
+}
+
+func (b *CircuitBreakerVerifier) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *CircuitBreakerVerifier) Stats() BreakerStats {
+	return BreakerStats{
+		State:     b.State().String(),
+		Opened:    b.opened.Load(),
+		Rejected:  b.rejected.Load(),
+		Retries:   b.retries.Load(),
+		Failures:  b.failed.Load(),
+		Successes: b.succeeded.Load(),
+	}
+}
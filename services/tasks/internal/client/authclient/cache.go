@@ -0,0 +1,156 @@
+package authclient
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pz1.2/shared/middleware"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type CacheConfig struct {
+	// Size is the maximum number of cached tokens.
+	Size int
+	// TTL is how long a valid token is trusted without asking again, but
+	// never past the token's expiry. A token revoked in the meantime is
+	// still accepted until then.
+	TTL time.Duration
+	// NegativeTTL is how long a rejected token stays rejected; it must be
+	// shorter than TTL.
+	NegativeTTL time.Duration
+}
+
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+type cacheEntry struct {
+	key       string
+	resp      *VerifyResponse
+	expiresAt time.Time
+}
+
+// CachingVerifier remembers the results of another AuthVerifier per token
+// in a bounded LRU cache. Concurrent lookups of the same token share one
+// call. Errors are never cached.
+type CachingVerifier struct {
+	next AuthVerifier
+	cfg  CacheConfig
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+
+	group  singleflight.Group
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func NewCachingVerifier(next AuthVerifier, cfg CacheConfig) *CachingVerifier {
+	return &CachingVerifier{
+		next:    next,
+		cfg:     cfg,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *CachingVerifier) Verify(ctx context.Context, token string) (*VerifyResponse, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	if resp, ok := c.get(key); ok {
+		c.hits.Add(1)
+		return resp, nil
+	}
+	c.misses.Add(1)
+
+	// The shared call must not fail because the first caller went away.
+	sharedCtx := context.WithoutCancel(ctx)
+	v, err, shared := c.group.Do(key, func() (interface{}, error) {
+		resp, err := c.next.Verify(sharedCtx, token)
+		if err != nil {
+			return nil, err
+		}
+		c.put(key, resp)
+		return resp, nil
+	})
+	if shared {
+		log.Printf("[%s] Shared in-flight token verification", middleware.GetRequestID(ctx))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*VerifyResponse), nil
+}
+
+func (c *CachingVerifier) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
+
+func (c *CachingVerifier) get(key string) (*VerifyResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return entry.resp, true
+}
+
+func (c *CachingVerifier) put(key string, resp *VerifyResponse) {
+	now := time.Now()
+	ttl := c.cfg.TTL
+	if !resp.Valid {
+		ttl = c.cfg.NegativeTTL
+	} else if resp.ExpiresAt != 0 {
+		if untilExpiry := time.Unix(resp.ExpiresAt, 0).Sub(now); untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+	if ttl <= 0 || c.cfg.Size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, resp: resp, expiresAt: now.Add(ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.cfg.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,58 @@
+package authclient
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingVerifier struct {
+	calls atomic.Int64
+	resp  VerifyResponse
+}
+
+func (v *countingVerifier) Verify(ctx context.Context, token string) (*VerifyResponse, error) {
+	v.calls.Add(1)
+	resp := v.resp
+	return &resp, nil
+}
+
+func TestCacheEntryDoesNotOutliveToken(t *testing.T) {
+	next := &countingVerifier{resp: VerifyResponse{Valid: true, Subject: "student", ExpiresAt: time.Now().Add(time.Second).Unix()}}
+	c := NewCachingVerifier(next, CacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Verify(context.Background(), "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("verifier called %d times before expiry, want 1", got)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := c.Verify(context.Background(), "token"); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.calls.Load(); got != 2 {
+		t.Fatalf("verifier called %d times after expiry, want 2", got)
+	}
+}
+
+func TestExpiredTokenIsNotCached(t *testing.T) {
+	next := &countingVerifier{resp: VerifyResponse{Valid: true, Subject: "student", ExpiresAt: time.Now().Add(-time.Second).Unix()}}
+	c := NewCachingVerifier(next, CacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Verify(context.Background(), "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := next.calls.Load(); got != 2 {
+		t.Fatalf("verifier called %d times, want 2", got)
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Fatalf("cache holds %d entries, want 0", size)
+	}
+}
@@ -2,6 +2,50 @@ package authclient
 
 import "context"
 
+type contextKey string
+
+const IdentityKey contextKey = "identity"
+
+// probeToken is sent to check that a verifier is reachable; any answer,
+// including "invalid token", counts as healthy.
+const probeToken = "health-probe"
+
 type AuthVerifier interface {
 	Verify(ctx context.Context, token string) (*VerifyResponse, error)
 }
+
+// Ping checks that v can reach the auth service (or, for JWKSVerifier,
+// has signing keys).
+func Ping(ctx context.Context, v AuthVerifier) error {
+	_, err := v.Verify(context.WithValue(ctx, probeKey{}, true), probeToken)
+	return err
+}
+
+func WithIdentity(ctx context.Context, resp *VerifyResponse) context.Context {
+	return context.WithValue(ctx, IdentityKey, resp)
+}
+
+func GetIdentity(ctx context.Context) *VerifyResponse {
+	if resp, ok := ctx.Value(IdentityKey).(*VerifyResponse); ok {
+		return resp
+	}
+	return nil
+}
+
+func (r *VerifyResponse) HasScope(scope string) bool {
+	for _, s := range r.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *VerifyResponse) HasRole(role string) bool {
+	for _, s := range r.Roles {
+		if s == role {
+			return true
+		}
+	}
+	return false
+}
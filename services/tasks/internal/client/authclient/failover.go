@@ -0,0 +1,141 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pz1.2/shared/middleware"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultProbeInterval = 5 * time.Second
+	defaultProbeTimeout  = 2 * time.Second
+)
+
+type FailoverConfig struct {
+	PrimaryName   string
+	SecondaryName string
+	// ProbeInterval is how often the primary is probed while requests go
+	// to the secondary. Non-positive values fall back to the defaults.
+	ProbeInterval time.Duration
+	ProbeTimeout  time.Duration
+}
+
+// FailoverVerifier sends verifications to the primary verifier and
+// switches to the secondary when the primary fails at the transport level.
+// While on the secondary it probes the primary and switches back once the
+// primary answers again.
+type FailoverVerifier struct {
+	primary   AuthVerifier
+	secondary AuthVerifier
+	cfg       FailoverConfig
+
+	onSecondary atomic.Bool
+	failovers   atomic.Uint64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewFailoverVerifier(primary, secondary AuthVerifier, cfg FailoverConfig) *FailoverVerifier {
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = defaultProbeInterval
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = defaultProbeTimeout
+	}
+	f := &FailoverVerifier{
+		primary:   primary,
+		secondary: secondary,
+		cfg:       cfg,
+		stop:      make(chan struct{}),
+	}
+	go f.probeLoop()
+	return f
+}
+
+func (f *FailoverVerifier) Verify(ctx context.Context, token string) (*VerifyResponse, error) {
+	if f.onSecondary.Load() {
+		return f.secondary.Verify(ctx, token)
+	}
+
+	resp, err := f.primary.Verify(ctx, token)
+	if err == nil || !isTransportError(err) || ctx.Err() != nil {
+		return resp, err
+	}
+
+	if f.onSecondary.CompareAndSwap(false, true) {
+		f.failovers.Add(1)
+		log.Printf("[%s] Auth %s unreachable (%v), failing over to %s",
+			middleware.GetRequestID(ctx), f.cfg.PrimaryName, err, f.cfg.SecondaryName)
+	}
+	return f.secondary.Verify(ctx, token)
+}
+
+// Active returns the name of the verifier currently in use.
+func (f *FailoverVerifier) Active() string {
+	if f.onSecondary.Load() {
+		return f.cfg.SecondaryName
+	}
+	return f.cfg.PrimaryName
+}
+
+func (f *FailoverVerifier) Failovers() uint64 {
+	return f.failovers.Load()
+}
+
+func (f *FailoverVerifier) Close() {
+	f.stopOnce.Do(func() { close(f.stop) })
+}
+
+func (f *FailoverVerifier) probeLoop() {
+	ticker := time.NewTicker(f.cfg.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+		if !f.onSecondary.Load() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), f.cfg.ProbeTimeout)
+		err := Ping(ctx, f.primary)
+		cancel()
+		if err != nil {
+			continue
+		}
+
+		if f.onSecondary.CompareAndSwap(true, false) {
+			log.Printf("Auth %s is reachable again, switching back from %s", f.cfg.PrimaryName, f.cfg.SecondaryName)
+		}
+	}
+}
+
+// isTransportError reports whether err means the verifier could not reach
+// the auth service or the service could not answer, as opposed to an
+// answer it did not understand.
+func isTransportError(err error) bool {
+	if IsTransient(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
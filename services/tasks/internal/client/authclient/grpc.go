@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	pb "pz1.2/proto/auth"
@@ -12,6 +13,9 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
 	"google.golang.org/grpc/status"
 )
 
@@ -21,10 +25,39 @@ type GRPCClient struct {
 	timeout time.Duration
 }
 
+// grpcServiceConfig balances calls round-robin over all auth addresses and
+// skips the ones whose health service does not report auth.AuthService as
+// serving.
+const grpcServiceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"healthCheckConfig": {"serviceName": "auth.AuthService"}
+}`
+
+// NewGRPCClient accepts a host:port, a comma-separated list of them or any
+// gRPC target such as dns:///auth:50051.
 func NewGRPCClient(addr string, timeout time.Duration) (*GRPCClient, error) {
-	conn, err := grpc.Dial(addr,
+	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+		grpc.WithDefaultServiceConfig(grpcServiceConfig),
+		grpc.WithChainUnaryInterceptor(middleware.UnaryClientRequestID(), middleware.UnaryClientTracing(), middleware.UnaryClientMetrics()),
+		grpc.WithStreamInterceptor(middleware.StreamClientRequestID()),
+	}
+
+	target := addr
+	if strings.Contains(addr, ",") {
+		r := manual.NewBuilderWithScheme("auth")
+		var addrs []resolver.Address
+		for _, a := range strings.Split(addr, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				addrs = append(addrs, resolver.Address{Addr: a})
+			}
+		}
+		r.InitialState(resolver.State{Addresses: addrs})
+		target = r.Scheme() + ":///auth"
+		opts = append(opts, grpc.WithResolvers(r))
+	}
+
+	conn, err := grpc.Dial(target, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("connect to auth service: %w", err)
 	}
@@ -59,8 +92,11 @@ func (c *GRPCClient) Verify(ctx context.Context, token string) (*VerifyResponse,
 
 	log.Printf("[%s] Auth gRPC verify: success, subject=%s", requestID, resp.Subject)
 	return &VerifyResponse{
-		Valid:   resp.Valid,
-		Subject: resp.Subject,
+		Valid:     resp.Valid,
+		Subject:   resp.Subject,
+		Roles:     resp.Roles,
+		Scopes:    resp.Scopes,
+		ExpiresAt: resp.ExpiresAt,
 	}, nil
 }
 
@@ -3,6 +3,7 @@ package authclient
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,36 +11,58 @@ import (
 	"time"
 
 	"pz1.2/shared/middleware"
+	"pz1.2/shared/problem"
 )
 
 type HTTPClient struct {
 	httpClient *http.Client
-	baseURL    string
+	pool       *endpointPool
 }
 
 type VerifyResponse struct {
-	Valid   bool   `json:"valid"`
-	Subject string `json:"subject,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Valid     bool     `json:"valid"`
+	Subject   string   `json:"subject,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	ExpiresAt int64    `json:"expires_at,omitempty"` // Unix seconds, 0 if unknown
+	Error     string   `json:"error,omitempty"`
 }
 
-func NewHTTPClient(baseURL string, timeout time.Duration) *HTTPClient {
+// NewHTTPClient accepts a base URL, a comma-separated list of them or a
+// dns:///host:port target. Requests are spread over the endpoints
+// round-robin; endpoints that keep failing are ejected for a while. Each
+// call makes a single attempt: retries are left to CircuitBreakerVerifier,
+// and since every call picks the next endpoint, a retry lands on another
+// instance.
+func NewHTTPClient(target string, timeout time.Duration) (*HTTPClient, error) {
+	pool, err := newEndpointPool(target)
+	if err != nil {
+		return nil, err
+	}
+
 	return &HTTPClient{
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
-		baseURL: baseURL,
-	}
+		pool: pool,
+	}, nil
 }
 
 func (c *HTTPClient) Verify(ctx context.Context, token string) (*VerifyResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.httpClient.Timeout)
 	defer cancel()
 
+	ep := c.pool.pick()
+	resp, err := c.verify(ctx, ep.url, token)
+	c.pool.report(ep, !endpointFailed(err))
+	return resp, err
+}
+
+func (c *HTTPClient) verify(ctx context.Context, baseURL, token string) (*VerifyResponse, error) {
 	requestID := middleware.GetRequestID(ctx)
-	log.Printf("[%s] Calling Auth HTTP verify", requestID)
+	log.Printf("[%s] Calling Auth HTTP verify at %s", requestID, baseURL)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/v1/auth/verify", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/v1/auth/verify", nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -49,7 +72,9 @@ func (c *HTTPClient) Verify(ctx context.Context, token string) (*VerifyResponse,
 		req.Header.Set("X-Request-ID", requestID)
 	}
 
+	req, span := middleware.TraceHTTPClient(req, "GET /v1/auth/verify")
 	resp, err := c.httpClient.Do(req)
+	middleware.FinishHTTPClient(span, resp, err)
 	if err != nil {
 		log.Printf("[%s] Auth HTTP verify failed: %v", requestID, err)
 		return nil, fmt.Errorf("auth service unavailable: %w", err)
@@ -61,21 +86,38 @@ func (c *HTTPClient) Verify(ctx context.Context, token string) (*VerifyResponse,
 		return nil, fmt.Errorf("read response: %w", err)
 	}
 
-	var verifyResp VerifyResponse
-	if err := json.Unmarshal(body, &verifyResp); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
-	}
-
 	if resp.StatusCode == http.StatusUnauthorized {
+		var p problem.Problem
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
 		log.Printf("[%s] Auth HTTP verify: unauthorized", requestID)
-		return &verifyResp, nil
+		return &VerifyResponse{Valid: false, Error: p.Detail}, nil
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("[%s] Auth HTTP verify: unexpected status %d", requestID, resp.StatusCode)
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+
+	var verifyResp VerifyResponse
+	if err := json.Unmarshal(body, &verifyResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
 	}
 
 	log.Printf("[%s] Auth HTTP verify: success, subject=%s", requestID, verifyResp.Subject)
 	return &verifyResp, nil
 }
+
+// endpointFailed reports whether err counts against the endpoint for
+// outlier ejection.
+func endpointFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= http.StatusInternalServerError
+	}
+	return isTransportError(err)
+}
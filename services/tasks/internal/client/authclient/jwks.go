@@ -0,0 +1,278 @@
+package authclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"pz1.2/shared/middleware"
+)
+
+const (
+	jwksCacheTTL        = 5 * time.Minute
+	jwksMinRefreshDelay = 10 * time.Second
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// ErrNoUsableKeys means the key set has no RS256 or EdDSA key, e.g. because
+// the auth service signs with HS256, whose keys are never published.
+var ErrNoUsableKeys = errors.New("JWKS has no RS256 or EdDSA keys")
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+	Scope string   `json:"scope,omitempty"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+// JWKSVerifier verifies access tokens locally with public keys fetched from
+// the auth service JWKS endpoint. Keys are cached and re-fetched when they
+// get stale or a token carries an unknown kid. Revoked tokens stay valid
+// until they expire, since the revocation list lives in the auth service.
+type JWKSVerifier struct {
+	httpClient *http.Client
+	jwksURL    string
+	issuer     string
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func NewJWKSVerifier(jwksURL, issuer string, timeout time.Duration) *JWKSVerifier {
+	return &JWKSVerifier{
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		jwksURL: jwksURL,
+		issuer:  issuer,
+		keys:    make(map[string]interface{}),
+	}
+}
+
+// Load fetches the key set and fails if none of its keys can verify tokens.
+func (v *JWKSVerifier) Load(ctx context.Context) error {
+	keys, err := v.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return ErrNoUsableKeys
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.lastAttempt = v.fetchedAt
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *JWKSVerifier) Verify(ctx context.Context, token string) (*VerifyResponse, error) {
+	requestID := middleware.GetRequestID(ctx)
+
+	var fetchErr error
+	if v.stale() {
+		fetchErr = v.refresh(ctx)
+	}
+
+	claims, err := v.parse(token)
+	if errors.Is(err, errUnknownKey) {
+		log.Printf("[%s] JWKS: unknown kid, refreshing keys", requestID)
+		if fetchErr = v.refresh(ctx); fetchErr == nil {
+			claims, err = v.parse(token)
+		}
+	}
+
+	if v.empty() {
+		if fetchErr == nil {
+			fetchErr = errors.New("no signing keys loaded")
+		}
+		return nil, fmt.Errorf("auth service unavailable: %w", fetchErr)
+	}
+
+	if err != nil {
+		log.Printf("[%s] JWKS verify: unauthorized: %v", requestID, err)
+		return &VerifyResponse{
+			Valid: false,
+			Error: "unauthorized",
+		}, nil
+	}
+
+	log.Printf("[%s] JWKS verify: success, subject=%s", requestID, claims.Subject)
+	return &VerifyResponse{
+		Valid:     true,
+		Subject:   claims.Subject,
+		Roles:     claims.Roles,
+		Scopes:    strings.Fields(claims.Scope),
+		ExpiresAt: claims.ExpiresAt.Unix(),
+	}, nil
+}
+
+func (v *JWKSVerifier) parse(token string) (*tokenClaims, error) {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, v.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		if errors.Is(err, errUnknownKey) {
+			return nil, errUnknownKey
+		}
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return &claims, nil
+}
+
+func (v *JWKSVerifier) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+func (v *JWKSVerifier) stale() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return time.Since(v.fetchedAt) > jwksCacheTTL
+}
+
+func (v *JWKSVerifier) empty() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.keys) == 0
+}
+
+// refresh re-fetches the key set. It does nothing if the previous attempt
+// was less than jwksMinRefreshDelay ago, so a flood of tokens with bogus
+// kids cannot hammer the auth service.
+func (v *JWKSVerifier) refresh(ctx context.Context) error {
+	v.mu.Lock()
+	if time.Since(v.lastAttempt) < jwksMinRefreshDelay {
+		v.mu.Unlock()
+		return nil
+	}
+	v.lastAttempt = time.Now()
+	v.mu.Unlock()
+
+	keys, err := v.fetch(ctx)
+	if err != nil {
+		log.Printf("[%s] JWKS fetch failed: %v", middleware.GetRequestID(ctx), err)
+		return err
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+
+	log.Printf("[%s] JWKS: loaded %d keys", middleware.GetRequestID(ctx), len(keys))
+	return nil
+}
+
+func (v *JWKSVerifier) fetch(ctx context.Context) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, v.httpClient.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if requestID := middleware.GetRequestID(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	req, span := middleware.TraceHTTPClient(req, "GET /.well-known/jwks.json")
+	resp, err := v.httpClient.Do(req)
+	middleware.FinishHTTPClient(span, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("JWKS: skipping key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode e: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
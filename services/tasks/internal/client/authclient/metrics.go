@@ -0,0 +1,89 @@
+package authclient
+
+import (
+	"context"
+
+	"pz1.2/shared/metrics"
+)
+
+var verifyTotal = metrics.NewCounterVec("authclient_verify_total",
+	"Token verifications by auth client and outcome (valid, invalid, error).", "client", "outcome")
+
+type probeKey struct{}
+
+// isProbe reports whether ctx belongs to a Ping, which should not be counted
+// as a verification.
+func isProbe(ctx context.Context) bool {
+	return ctx.Value(probeKey{}) != nil
+}
+
+// InstrumentedVerifier counts the outcomes of the verifier it wraps.
+type InstrumentedVerifier struct {
+	next   AuthVerifier
+	client string
+}
+
+func NewInstrumentedVerifier(client string, next AuthVerifier) *InstrumentedVerifier {
+	return &InstrumentedVerifier{next: next, client: client}
+}
+
+func (v *InstrumentedVerifier) Verify(ctx context.Context, token string) (*VerifyResponse, error) {
+	resp, err := v.next.Verify(ctx, token)
+	if isProbe(ctx) {
+		return resp, err
+	}
+
+	outcome := "valid"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case !resp.Valid:
+		outcome = "invalid"
+	}
+	verifyTotal.Inc(v.client, outcome)
+	return resp, err
+}
+
+// RegisterBreakerMetrics exposes the statistics of b.
+func RegisterBreakerMetrics(b *CircuitBreakerVerifier) {
+	metrics.NewGaugeFunc("authclient_breaker_state",
+		"Auth circuit breaker state: 0 closed, 1 open, 2 half-open.",
+		func() float64 { return float64(b.State()) })
+	metrics.NewCounterFunc("authclient_breaker_opened_total",
+		"Times the auth circuit breaker opened.",
+		func() float64 { return float64(b.Stats().Opened) })
+	metrics.NewCounterFunc("authclient_breaker_rejected_total",
+		"Verifications rejected while the auth circuit breaker was open.",
+		func() float64 { return float64(b.Stats().Rejected) })
+	metrics.NewCounterFunc("authclient_breaker_retries_total",
+		"Retries of transient auth errors.",
+		func() float64 { return float64(b.Stats().Retries) })
+}
+
+// RegisterCacheMetrics exposes the statistics of c.
+func RegisterCacheMetrics(c *CachingVerifier) {
+	metrics.NewCounterFunc("authclient_cache_hits_total",
+		"Token verifications answered from the cache.",
+		func() float64 { return float64(c.Stats().Hits) })
+	metrics.NewCounterFunc("authclient_cache_misses_total",
+		"Token verifications that missed the cache.",
+		func() float64 { return float64(c.Stats().Misses) })
+	metrics.NewGaugeFunc("authclient_cache_entries",
+		"Entries in the token verification cache.",
+		func() float64 { return float64(c.Stats().Size) })
+}
+
+// RegisterFailoverMetrics exposes the state of f.
+func RegisterFailoverMetrics(f *FailoverVerifier) {
+	metrics.NewGaugeFunc("authclient_failover_on_secondary",
+		"1 while verifications go to the secondary auth client.",
+		func() float64 {
+			if f.onSecondary.Load() {
+				return 1
+			}
+			return 0
+		})
+	metrics.NewCounterFunc("authclient_failovers_total",
+		"Switches from the primary to the secondary auth client.",
+		func() float64 { return float64(f.Failovers()) })
+}
@@ -0,0 +1,168 @@
+package authclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// An endpoint is ejected after this many consecutive failures...
+	ejectionThreshold = 3
+	// ...for ejectionBase, doubled on every further ejection up to
+	// maxEjection. A success resets both.
+	ejectionBase = 10 * time.Second
+	maxEjection  = 2 * time.Minute
+
+	dnsRefreshInterval = 30 * time.Second
+	dnsScheme          = "dns:///"
+)
+
+type endpoint struct {
+	url string
+
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// endpointPool spreads requests over auth HTTP endpoints round-robin and
+// ejects endpoints that keep failing (outlier ejection). A dns:/// target
+// is re-resolved periodically, one endpoint per address.
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+
+	dnsHost    string
+	dnsPort    string
+	scheme     string
+	resolvedAt time.Time
+	resolving  bool
+}
+
+// newEndpointPool parses a comma-separated list of base URLs, or a
+// dns:///host:port target whose addresses are reached over plain http.
+func newEndpointPool(target string) (*endpointPool, error) {
+	p := &endpointPool{}
+
+	if strings.HasPrefix(target, dnsScheme) {
+		host, port, err := net.SplitHostPort(strings.TrimPrefix(target, dnsScheme))
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns target %q: %w", target, err)
+		}
+		p.dnsHost, p.dnsPort, p.scheme = host, port, "http"
+		if err := p.resolve(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	for _, u := range strings.Split(target, ",") {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u != "" {
+			p.endpoints = append(p.endpoints, &endpoint{url: u})
+		}
+	}
+	if len(p.endpoints) == 0 {
+		return nil, fmt.Errorf("no auth endpoints in %q", target)
+	}
+	return p, nil
+}
+
+// pick returns the next endpoint that is not ejected. If every endpoint is
+// ejected, the one whose ejection ends first is used anyway.
+func (p *endpointPool) pick() *endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dnsHost != "" && !p.resolving && time.Since(p.resolvedAt) > dnsRefreshInterval {
+		p.resolving = true
+		go func() {
+			if err := p.resolve(); err != nil {
+				log.Printf("Failed to resolve auth endpoints: %v", err)
+			}
+		}()
+	}
+
+	now := time.Now()
+	var fallback *endpoint
+	for i := 0; i < len(p.endpoints); i++ {
+		ep := p.endpoints[(p.next+i)%len(p.endpoints)]
+		if !now.Before(ep.ejectedUntil) {
+			p.next = (p.next + i + 1) % len(p.endpoints)
+			return ep
+		}
+		if fallback == nil || ep.ejectedUntil.Before(fallback.ejectedUntil) {
+			fallback = ep
+		}
+	}
+	return fallback
+}
+
+func (p *endpointPool) report(ep *endpoint, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ok {
+		if ep.ejections > 0 {
+			log.Printf("Auth endpoint %s is healthy again", ep.url)
+		}
+		ep.failures = 0
+		ep.ejections = 0
+		return
+	}
+
+	ep.failures++
+	if ep.failures < ejectionThreshold {
+		return
+	}
+
+	d := ejectionBase << ep.ejections
+	if d > maxEjection || d <= 0 {
+		d = maxEjection
+	}
+	ep.ejections++
+	ep.failures = 0
+	ep.ejectedUntil = time.Now().Add(d)
+	log.Printf("Auth endpoint %s ejected for %s", ep.url, d)
+}
+
+// resolve replaces the endpoints with the current addresses of the dns
+// target, keeping the state of addresses that are still there.
+func (p *endpointPool) resolve() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, p.dnsHost)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resolving = false
+	p.resolvedAt = time.Now()
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", p.dnsHost, err)
+	}
+
+	known := make(map[string]*endpoint, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		known[ep.url] = ep
+	}
+	endpoints := make([]*endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		u := p.scheme + "://" + net.JoinHostPort(addr, p.dnsPort)
+		if ep, ok := known[u]; ok {
+			endpoints = append(endpoints, ep)
+		} else {
+			endpoints = append(endpoints, &endpoint{url: u})
+		}
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("resolve %s: no addresses", p.dnsHost)
+	}
+	p.endpoints = endpoints
+	return nil
+}
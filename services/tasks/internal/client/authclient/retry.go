@@ -0,0 +1,49 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusError is an unexpected HTTP status from the auth service.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d", e.Code)
+}
+
+// IsTransient reports whether err is likely to go away on retry: a refused
+// or reset connection, an overloaded or restarting auth service. Timeouts
+// are not transient, since retrying them only makes the caller wait longer.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.Code {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+		return st.Code() == codes.Unavailable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout()
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package grpc
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	pb "pz1.2/proto/tasks"
+	"pz1.2/services/tasks/internal/client/authclient"
+	"pz1.2/shared/middleware"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	scopeTasksRead  = "tasks:read"
+	scopeTasksWrite = "tasks:write"
+
+	roleAdmin = "admin"
+)
+
+// methodScopes lists the scopes each RPC requires, as the HTTP routes do.
+var methodScopes = map[string]string{
+	pb.TaskService_Create_FullMethodName: scopeTasksWrite,
+	pb.TaskService_Get_FullMethodName:    scopeTasksRead,
+	pb.TaskService_List_FullMethodName:   scopeTasksRead,
+	pb.TaskService_Update_FullMethodName: scopeTasksWrite,
+	pb.TaskService_Delete_FullMethodName: scopeTasksWrite,
+
+	pb.TaskService_WatchTasks_FullMethodName: scopeTasksRead,
+}
+
+// AuthInterceptor verifies the bearer token from the "authorization"
+// metadata and checks the scope required by the called method. The
+// verified identity is stored in the context for the handler.
+func AuthInterceptor(verifier authclient.AuthVerifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, verifier, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor is AuthInterceptor for streaming methods.
+func AuthStreamInterceptor(verifier authclient.AuthVerifier) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), verifier, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, middleware.WrapServerStream(ctx, ss))
+	}
+}
+
+func authorize(ctx context.Context, verifier authclient.AuthVerifier, method string) (context.Context, error) {
+	requestID := middleware.GetRequestID(ctx)
+	token, err := bearerToken(ctx)
+	if err != nil {
+		log.Printf("[%s] [gRPC] %s: %v", requestID, method, err)
+		return nil, err
+	}
+
+	verifyResp, err := verifier.Verify(ctx, token)
+	if err != nil {
+		log.Printf("[%s] [gRPC] Auth service unavailable: %v", requestID, err)
+		return nil, status.Error(codes.Unavailable, "auth service unavailable")
+	}
+
+	if !verifyResp.Valid {
+		log.Printf("[%s] [gRPC] Invalid token for %s", requestID, method)
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	scope, ok := methodScopes[method]
+	if !ok || !verifyResp.HasScope(scope) {
+		log.Printf("[%s] [gRPC] Subject %s lacks scope for %s", requestID, verifyResp.Subject, method)
+		return nil, status.Error(codes.PermissionDenied, "insufficient scope")
+	}
+
+	return authclient.WithIdentity(ctx, verifyResp), nil
+}
+
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	parts := strings.SplitN(values[0], " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return "", status.Error(codes.Unauthenticated, "invalid authorization format")
+	}
+
+	return parts[1], nil
+}
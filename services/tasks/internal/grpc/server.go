@@ -0,0 +1,285 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pb "pz1.2/proto/tasks"
+	"pz1.2/services/tasks/internal/client/authclient"
+	"pz1.2/services/tasks/internal/service"
+	"pz1.2/shared/middleware"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Server struct {
+	pb.UnimplementedTaskServiceServer
+	taskService *service.TaskService
+}
+
+func NewServer(taskService *service.TaskService) *Server {
+	return &Server{taskService: taskService}
+}
+
+func (s *Server) Create(ctx context.Context, req *pb.CreateTaskRequest) (*pb.Task, error) {
+	requestID := middleware.GetRequestID(ctx)
+	log.Printf("[%s] [gRPC] Create task request", requestID)
+
+	if req.Title == "" {
+		return nil, status.Error(codes.InvalidArgument, "title is required")
+	}
+	due, err := fromTimestamp("due_date", req.DueDate)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := s.taskService.Create(callerFromContext(ctx), service.CreateTaskRequest{
+		Title:       req.Title,
+		Description: req.Description,
+		DueDate:     due,
+	})
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	log.Printf("[%s] [gRPC] Task created: %s", requestID, task.ID)
+	return toProto(task), nil
+}
+
+func (s *Server) Get(ctx context.Context, req *pb.GetTaskRequest) (*pb.Task, error) {
+	requestID := middleware.GetRequestID(ctx)
+	log.Printf("[%s] [gRPC] Get task: %s", requestID, req.Id)
+
+	task, err := s.taskService.GetByID(callerFromContext(ctx), req.Id)
+	if err != nil {
+		return nil, taskError(err)
+	}
+	return toProto(task), nil
+}
+
+func (s *Server) List(ctx context.Context, req *pb.ListTasksRequest) (*pb.ListTasksResponse, error) {
+	requestID := middleware.GetRequestID(ctx)
+	log.Printf("[%s] [gRPC] List tasks request", requestID)
+
+	if req.Limit < 0 || req.Limit > service.MaxPageLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 0 (default) and %d", service.MaxPageLimit)
+	}
+	switch req.Sort {
+	case "", service.SortCreatedAt, service.SortDueDate, service.SortTitle:
+	default:
+		return nil, status.Error(codes.InvalidArgument, "sort must be one of created_at, due_date, title")
+	}
+
+	opts := service.ListOptions{
+		Limit:   int(req.Limit),
+		Cursor:  req.Cursor,
+		Done:    req.Done,
+		Overdue: req.Overdue,
+		Query:   req.Query,
+		Sort:    req.Sort,
+		Desc:    req.Desc,
+	}
+	dueBefore, err := fromTimestamp("due_before", req.DueBefore)
+	if err != nil {
+		return nil, err
+	}
+	if dueBefore != nil {
+		opts.DueBefore = *dueBefore
+	}
+	dueAfter, err := fromTimestamp("due_after", req.DueAfter)
+	if err != nil {
+		return nil, err
+	}
+	if dueAfter != nil {
+		opts.DueAfter = *dueAfter
+	}
+
+	page, err := s.taskService.GetAll(callerFromContext(ctx), opts)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	resp := &pb.ListTasksResponse{
+		Items:      make([]*pb.Task, 0, len(page.Items)),
+		NextCursor: page.NextCursor,
+	}
+	for _, task := range page.Items {
+		resp.Items = append(resp.Items, toProto(task))
+	}
+	return resp, nil
+}
+
+func (s *Server) Update(ctx context.Context, req *pb.UpdateTaskRequest) (*pb.Task, error) {
+	requestID := middleware.GetRequestID(ctx)
+	if req.Task == nil || req.Task.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "task.id is required")
+	}
+	log.Printf("[%s] [gRPC] Update task: %s", requestID, req.Task.Id)
+
+	if len(req.UpdateMask.GetPaths()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_mask is required")
+	}
+
+	var update service.UpdateTaskRequest
+	for _, path := range req.UpdateMask.GetPaths() {
+		switch path {
+		case "title":
+			if req.Task.Title == "" {
+				return nil, status.Error(codes.InvalidArgument, "title must not be empty")
+			}
+			update.Title = &req.Task.Title
+		case "description":
+			update.Description = &req.Task.Description
+		case "due_date":
+			due, err := fromTimestamp("task.due_date", req.Task.DueDate)
+			if err != nil {
+				return nil, err
+			}
+			update.DueDate = due
+			update.ClearDueDate = update.DueDate == nil
+		case "done":
+			update.Done = &req.Task.Done
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask: unknown or immutable field %q", path)
+		}
+	}
+
+	task, err := s.taskService.Update(callerFromContext(ctx), req.Task.Id, update, req.Version)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	log.Printf("[%s] [gRPC] Task updated: %s", requestID, task.ID)
+	return toProto(task), nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteTaskRequest) (*pb.DeleteTaskResponse, error) {
+	requestID := middleware.GetRequestID(ctx)
+	log.Printf("[%s] [gRPC] Delete task: %s", requestID, req.Id)
+
+	if err := s.taskService.Delete(callerFromContext(ctx), req.Id, req.Version); err != nil {
+		return nil, taskError(err)
+	}
+
+	log.Printf("[%s] [gRPC] Task deleted: %s", requestID, req.Id)
+	return &pb.DeleteTaskResponse{}, nil
+}
+
+func (s *Server) WatchTasks(req *pb.WatchTasksRequest, stream pb.TaskService_WatchTasksServer) error {
+	requestID := middleware.GetRequestID(stream.Context())
+	caller := callerFromContext(stream.Context())
+	log.Printf("[%s] [gRPC] Watch tasks for %s from event %q", requestID, caller.Subject, req.LastEventId)
+
+	sub, err := s.taskService.Watch(caller, req.LastEventId)
+	if errors.Is(err, service.ErrInvalidEventID) {
+		return status.Error(codes.InvalidArgument, "invalid last_event_id")
+	}
+	if errors.Is(err, service.ErrEventsExpired) {
+		return status.Error(codes.OutOfRange, "events expired, list tasks again")
+	}
+	if err != nil {
+		return taskError(err)
+	}
+	defer sub.Close()
+
+	for _, event := range sub.Backlog {
+		if err := stream.Send(eventToProto(event)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return status.Error(codes.Unavailable, "watch ended, resume from the last event")
+			}
+			if err := stream.Send(eventToProto(event)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func callerFromContext(ctx context.Context) service.Caller {
+	identity := authclient.GetIdentity(ctx)
+	if identity == nil {
+		return service.Caller{}
+	}
+	return service.Caller{
+		Subject: identity.Subject,
+		Admin:   identity.HasRole(roleAdmin),
+	}
+}
+
+func taskError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		return status.Error(codes.NotFound, "task not found")
+	case errors.Is(err, service.ErrVersionMismatch):
+		return status.Error(codes.FailedPrecondition, "task version mismatch")
+	case errors.Is(err, service.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, "invalid cursor")
+	}
+
+	log.Printf("[gRPC] Task storage error: %v", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+func toProto(task *service.Task) *pb.Task {
+	return &pb.Task{
+		Id:          task.ID,
+		Owner:       task.Owner,
+		Title:       task.Title,
+		Description: task.Description,
+		DueDate:     toTimestamp(task.DueDate),
+		Done:        task.Done,
+		CreatedAt:   timestamppb.New(task.CreatedAt),
+		Version:     task.Version,
+	}
+}
+
+func eventToProto(event service.Event) *pb.TaskEvent {
+	e := &pb.TaskEvent{
+		Id:      event.ID,
+		Type:    event.Type,
+		TaskId:  event.TaskID,
+		Version: event.Version,
+		Time:    timestamppb.New(event.Time),
+	}
+	if event.Task != nil {
+		e.Task = toProto(event.Task)
+	}
+	return e
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// fromTimestamp converts an optional timestamp field. Out-of-range values
+// are rejected rather than normalized.
+func fromTimestamp(field string, ts *timestamppb.Timestamp) (*time.Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s: %v", field, err)
+	}
+	t := ts.AsTime()
+	return &t, nil
+}
+
+func RegisterServer(s *grpc.Server, taskService *service.TaskService) {
+	pb.RegisterTaskServiceServer(s, NewServer(taskService))
+}
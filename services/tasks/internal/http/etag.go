@@ -0,0 +1,55 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion extracts the version required by If-Match. It returns 0
+// when the header is absent or "*" (any current version) and false when the
+// header cannot match any version: weak tags never match under the strong
+// comparison If-Match requires, and lists of tags are not supported.
+func ifMatchVersion(r *http.Request) (int64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+
+	tag, ok := strings.CutPrefix(header, `"`)
+	if !ok {
+		return 0, false
+	}
+	tag, ok = strings.CutSuffix(tag, `"`)
+	if !ok {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// noneMatch reports whether If-None-Match lists the given version, using
+// the weak comparison that If-None-Match allows.
+func noneMatch(r *http.Request, version int64) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
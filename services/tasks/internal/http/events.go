@@ -0,0 +1,101 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"pz1.2/services/tasks/internal/service"
+	"pz1.2/shared/middleware"
+	"pz1.2/shared/problem"
+)
+
+const sseKeepAlive = 15 * time.Second
+
+// handleEvents streams task changes as Server-Sent Events. Clients resume
+// with the Last-Event-ID header (sent by EventSource on reconnect) or the
+// last_event_id query parameter.
+func (h *Handler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetRequestID(r.Context())
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	caller := callerFromRequest(r)
+	sub, err := h.taskService.Watch(caller, lastEventID)
+	if errors.Is(err, service.ErrInvalidEventID) {
+		problem.Write(w, r, problem.Validation(fieldErrors{"Last-Event-ID": "must be an event id"}))
+		return
+	}
+	if errors.Is(err, service.ErrEventsExpired) {
+		problem.Error(w, r, http.StatusGone, "events after this id are no longer available, list tasks again")
+		return
+	}
+	if err != nil {
+		h.respondError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	// The server write timeout would cut the stream off.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[%s] Cannot stream events: %v", requestID, err)
+		problem.Error(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	log.Printf("[%s] Streaming task events for %s from event %q", requestID, caller.Subject, lastEventID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range sub.Backlog {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				log.Printf("[%s] Task event stream ended", requestID)
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event service.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -1,51 +1,86 @@
 package http
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"pz1.2/services/tasks/internal/client/authclient"
+	"pz1.2/services/tasks/internal/idempotency"
 	"pz1.2/services/tasks/internal/service"
+	"pz1.2/services/tasks/internal/webhook"
 	"pz1.2/shared/middleware"
+	"pz1.2/shared/problem"
 )
 
 type Handler struct {
 	taskService  *service.TaskService
 	authVerifier authclient.AuthVerifier
+	idempotency  *idempotency.Store
+	webhooks     *webhook.Store
+	destinations *webhook.Destinations
 }
 
-func NewHandler(taskService *service.TaskService, authVerifier authclient.AuthVerifier) *Handler {
+func NewHandler(taskService *service.TaskService, authVerifier authclient.AuthVerifier, idempotencyStore *idempotency.Store, webhooks *webhook.Store, destinations *webhook.Destinations) *Handler {
 	return &Handler{
 		taskService:  taskService,
 		authVerifier: authVerifier,
+		idempotency:  idempotencyStore,
+		webhooks:     webhooks,
+		destinations: destinations,
 	}
 }
 
+const (
+	scopeTasksRead  = "tasks:read"
+	scopeTasksWrite = "tasks:write"
+
+	roleAdmin = "admin"
+
+	maxIdempotencyKeyLen = 255
+)
+
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("POST /v1/tasks", h.authMiddleware(h.handleCreate))
-	mux.HandleFunc("GET /v1/tasks", h.authMiddleware(h.handleGetAll))
-	mux.HandleFunc("GET /v1/tasks/{id}", h.authMiddleware(h.handleGetByID))
-	mux.HandleFunc("PATCH /v1/tasks/{id}", h.authMiddleware(h.handleUpdate))
-	mux.HandleFunc("DELETE /v1/tasks/{id}", h.authMiddleware(h.handleDelete))
+	mux.HandleFunc("POST /v1/tasks", h.authMiddleware(h.handleCreate, scopeTasksWrite))
+	mux.HandleFunc("GET /v1/tasks", h.authMiddleware(h.handleGetAll, scopeTasksRead))
+	mux.HandleFunc("GET /v1/tasks/due", h.authMiddleware(h.handleDue, scopeTasksRead))
+	mux.HandleFunc("GET /v1/tasks/events", h.authMiddleware(h.handleEvents, scopeTasksRead))
+	mux.HandleFunc("GET /v1/tasks/{id}", h.authMiddleware(h.handleGetByID, scopeTasksRead))
+	mux.HandleFunc("PATCH /v1/tasks/{id}", h.authMiddleware(h.handleUpdate, scopeTasksWrite))
+	mux.HandleFunc("DELETE /v1/tasks/{id}", h.authMiddleware(h.handleDelete, scopeTasksWrite))
+
+	mux.HandleFunc("POST /v1/webhooks", h.authMiddleware(h.handleCreateWebhook, scopeTasksRead, scopeTasksWrite))
+	mux.HandleFunc("GET /v1/webhooks", h.authMiddleware(h.handleListWebhooks, scopeTasksRead))
+	mux.HandleFunc("GET /v1/webhooks/dead-letters", h.authMiddleware(h.handleDeadLetters, scopeTasksRead))
+	mux.HandleFunc("GET /v1/webhooks/{id}", h.authMiddleware(h.handleGetWebhook, scopeTasksRead))
+	mux.HandleFunc("DELETE /v1/webhooks/{id}", h.authMiddleware(h.handleDeleteWebhook, scopeTasksWrite))
+	mux.HandleFunc("GET /v1/webhooks/{id}/deliveries", h.authMiddleware(h.handleWebhookDeliveries, scopeTasksRead))
 }
 
-func (h *Handler) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// authMiddleware verifies the bearer token and requires the token to carry
+// every one of the given scopes.
+func (h *Handler) authMiddleware(next http.HandlerFunc, scopes ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestID := middleware.GetRequestID(r.Context())
 
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			log.Printf("[%s] Missing authorization header", requestID)
-			h.respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing authorization header"})
+			problem.Write(w, r, problem.New(http.StatusUnauthorized, "missing authorization header").WithType(problem.TypeInvalidToken))
 			return
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 			log.Printf("[%s] Invalid authorization format", requestID)
-			h.respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid authorization format"})
+			problem.Write(w, r, problem.New(http.StatusUnauthorized, "invalid authorization format").WithType(problem.TypeInvalidToken))
 			return
 		}
 
@@ -54,18 +89,37 @@ func (h *Handler) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		verifyResp, err := h.authVerifier.Verify(r.Context(), token)
 		if err != nil {
 			log.Printf("[%s] Auth service unavailable: %v", requestID, err)
-			h.respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "auth service unavailable"})
+			problem.Error(w, r, http.StatusServiceUnavailable, "auth service unavailable")
 			return
 		}
 
 		if !verifyResp.Valid {
 			log.Printf("[%s] Invalid token", requestID)
-			h.respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+			problem.Write(w, r, problem.New(http.StatusUnauthorized, "invalid token").WithType(problem.TypeInvalidToken))
 			return
 		}
 
+		for _, scope := range scopes {
+			if !verifyResp.HasScope(scope) {
+				log.Printf("[%s] Subject %s lacks scope %s", requestID, verifyResp.Subject, scope)
+				problem.Write(w, r, problem.New(http.StatusForbidden, "insufficient scope: "+scope+" required").WithType(problem.TypeInsufficientScope))
+				return
+			}
+		}
+
 		log.Printf("[%s] Token verified for subject: %s", requestID, verifyResp.Subject)
-		next(w, r)
+		next(w, r.WithContext(authclient.WithIdentity(r.Context(), verifyResp)))
+	}
+}
+
+func callerFromRequest(r *http.Request) service.Caller {
+	identity := authclient.GetIdentity(r.Context())
+	if identity == nil {
+		return service.Caller{}
+	}
+	return service.Caller{
+		Subject: identity.Subject,
+		Admin:   identity.HasRole(roleAdmin),
 	}
 }
 
@@ -73,28 +127,182 @@ func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
 	requestID := middleware.GetRequestID(r.Context())
 	log.Printf("[%s] Creating new task", requestID)
 
-	var req service.CreateTaskRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	var body createTaskBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	if req.Title == "" {
-		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "title is required"})
+	req, errs := body.validate()
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+
+	caller := callerFromRequest(r)
+
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" {
+		if len(key) > maxIdempotencyKeyLen {
+			problem.Write(w, r, problem.Validation(fieldErrors{"Idempotency-Key": fmt.Sprintf("must be at most %d characters", maxIdempotencyKeyLen)}))
+			return
+		}
+
+		stored, err := h.idempotency.Begin(caller.Subject, key, fingerprint(req))
+		switch {
+		case errors.Is(err, idempotency.ErrKeyReused):
+			log.Printf("[%s] Idempotency key %q reused with a different body", requestID, key)
+			problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "idempotency key reused with a different request").WithType(problem.TypeIdempotencyKey))
+			return
+		case errors.Is(err, idempotency.ErrInProgress):
+			problem.Write(w, r, problem.New(http.StatusConflict, "request with this idempotency key is in progress").WithType(problem.TypeIdempotencyKey))
+			return
+		case stored != nil:
+			log.Printf("[%s] Replaying response for idempotency key %q", requestID, key)
+			h.respondStored(w, stored)
+			return
+		}
+	}
+
+	task, err := h.taskService.Create(caller, req)
+	if err != nil {
+		if key != "" {
+			h.idempotency.Abort(caller.Subject, key)
+		}
+		h.respondError(w, r, err)
 		return
 	}
 
-	task := h.taskService.Create(req)
 	log.Printf("[%s] Task created: %s", requestID, task.ID)
+	w.Header().Set("ETag", etag(task.Version))
+
+	if key != "" {
+		body, _ := json.Marshal(task)
+		h.idempotency.Complete(caller.Subject, key, &idempotency.Response{
+			Status: http.StatusCreated,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+				"Etag":         {etag(task.Version)},
+			},
+			Body: append(body, '\n'),
+		})
+	}
+
 	h.respondJSON(w, http.StatusCreated, task)
 }
 
+// fingerprint identifies the request body independently of formatting.
+func fingerprint(req service.CreateTaskRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func (h *Handler) handleGetAll(w http.ResponseWriter, r *http.Request) {
 	requestID := middleware.GetRequestID(r.Context())
 	log.Printf("[%s] Getting all tasks", requestID)
 
-	tasks := h.taskService.GetAll()
-	h.respondJSON(w, http.StatusOK, tasks)
+	opts, errs := parseListOptions(r)
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+
+	page, err := h.taskService.GetAll(callerFromRequest(r), opts)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			problem.Write(w, r, problem.Validation(fieldErrors{"cursor": "is invalid or was issued for a different sort"}))
+			return
+		}
+		h.respondError(w, r, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) handleDue(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetRequestID(r.Context())
+	log.Printf("[%s] Getting tasks due soon", requestID)
+
+	within, err := time.ParseDuration(r.URL.Query().Get("within"))
+	if err != nil || within <= 0 {
+		problem.Write(w, r, problem.Validation(fieldErrors{"within": "must be a positive duration, e.g. 48h"}))
+		return
+	}
+
+	tasks, err := h.taskService.DueWithin(callerFromRequest(r), within)
+	if err != nil {
+		h.respondError(w, r, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, service.TaskPage{Items: tasks})
+}
+
+func parseListOptions(r *http.Request) (service.ListOptions, fieldErrors) {
+	q := r.URL.Query()
+	opts := service.ListOptions{
+		Cursor: q.Get("cursor"),
+		Query:  q.Get("q"),
+	}
+
+	for name, dst := range map[string]*time.Time{"due_before": &opts.DueBefore, "due_after": &opts.DueAfter} {
+		if v := q.Get(name); v != "" {
+			t, err := parseDateParam(v)
+			if err != nil {
+				return opts, fieldErrors{name: err.Error()}
+			}
+			*dst = t
+		}
+	}
+
+	if v := q.Get("overdue"); v != "" {
+		overdue, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fieldErrors{"overdue": "must be true or false"}
+		}
+		opts.Overdue = &overdue
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > service.MaxPageLimit {
+			return opts, fieldErrors{"limit": fmt.Sprintf("must be between 1 and %d", service.MaxPageLimit)}
+		}
+		opts.Limit = limit
+	}
+
+	if v := q.Get("done"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fieldErrors{"done": "must be true or false"}
+		}
+		opts.Done = &done
+	}
+
+	// sort=due_date or sort=-due_date / sort=due_date:desc
+	if v := q.Get("sort"); v != "" {
+		field, order, _ := strings.Cut(v, ":")
+		if strings.HasPrefix(field, "-") {
+			field, order = field[1:], "desc"
+		}
+		switch field {
+		case service.SortCreatedAt, service.SortDueDate, service.SortTitle:
+		default:
+			return opts, fieldErrors{"sort": "must be one of created_at, due_date, title"}
+		}
+		switch order {
+		case "", "asc":
+		case "desc":
+			opts.Desc = true
+		default:
+			return opts, fieldErrors{"sort": "order must be asc or desc"}
+		}
+		opts.Sort = field
+	}
+
+	return opts, nil
 }
 
 func (h *Handler) handleGetByID(w http.ResponseWriter, r *http.Request) {
@@ -102,9 +310,15 @@ func (h *Handler) handleGetByID(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	log.Printf("[%s] Getting task: %s", requestID, id)
 
-	task, err := h.taskService.GetByID(id)
+	task, err := h.taskService.GetByID(callerFromRequest(r), id)
 	if err != nil {
-		h.respondJSON(w, http.StatusNotFound, map[string]string{"error": "task not found"})
+		h.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(task.Version))
+	if noneMatch(r, task.Version) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
@@ -116,19 +330,32 @@ func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	log.Printf("[%s] Updating task: %s", requestID, id)
 
-	var req service.UpdateTaskRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		h.respondPreconditionFailed(w, r)
+		return
+	}
+
+	var body updateTaskBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	task, err := h.taskService.Update(id, req)
+	req, errs := body.validate()
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+
+	task, err := h.taskService.Update(callerFromRequest(r), id, req, version)
 	if err != nil {
-		h.respondJSON(w, http.StatusNotFound, map[string]string{"error": "task not found"})
+		h.respondError(w, r, err)
 		return
 	}
 
 	log.Printf("[%s] Task updated: %s", requestID, id)
+	w.Header().Set("ETag", etag(task.Version))
 	h.respondJSON(w, http.StatusOK, task)
 }
 
@@ -137,8 +364,14 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	log.Printf("[%s] Deleting task: %s", requestID, id)
 
-	if err := h.taskService.Delete(id); err != nil {
-		h.respondJSON(w, http.StatusNotFound, map[string]string{"error": "task not found"})
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		h.respondPreconditionFailed(w, r)
+		return
+	}
+
+	if err := h.taskService.Delete(callerFromRequest(r), id, version); err != nil {
+		h.respondError(w, r, err)
 		return
 	}
 
@@ -146,6 +379,34 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *Handler) respondError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrTaskNotFound) {
+		problem.Error(w, r, http.StatusNotFound, "task not found")
+		return
+	}
+	if errors.Is(err, service.ErrVersionMismatch) {
+		h.respondPreconditionFailed(w, r)
+		return
+	}
+
+	log.Printf("[%s] Task storage error: %v", middleware.GetRequestID(r.Context()), err)
+	problem.Error(w, r, http.StatusInternalServerError, "internal error")
+}
+
+func (h *Handler) respondPreconditionFailed(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, problem.New(http.StatusPreconditionFailed, "task version does not match If-Match").
+		WithType(problem.TypePreconditionFailed))
+}
+
+func (h *Handler) respondStored(w http.ResponseWriter, resp *idempotency.Response) {
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
 func (h *Handler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
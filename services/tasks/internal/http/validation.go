@@ -0,0 +1,124 @@
+package http
+
+import (
+	"errors"
+	"time"
+
+	"pz1.2/services/tasks/internal/service"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	errInvalidDate     = errors.New("must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	errInvalidTimezone = errors.New("must be an IANA time zone name, e.g. Europe/Moscow")
+)
+
+// fieldErrors maps a request field to what is wrong with it.
+type fieldErrors map[string]string
+
+type createTaskBody struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	DueDate     string `json:"due_date"`
+	Timezone    string `json:"timezone"`
+}
+
+type updateTaskBody struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	DueDate     *string `json:"due_date,omitempty"`
+	Timezone    string  `json:"timezone,omitempty"`
+	Done        *bool   `json:"done,omitempty"`
+}
+
+func (b createTaskBody) validate() (service.CreateTaskRequest, fieldErrors) {
+	errs := fieldErrors{}
+	req := service.CreateTaskRequest{
+		Title:       b.Title,
+		Description: b.Description,
+	}
+
+	if b.Title == "" {
+		errs["title"] = "is required"
+	}
+
+	loc, err := loadLocation(b.Timezone)
+	if err != nil {
+		errs["timezone"] = err.Error()
+	} else if b.DueDate != "" {
+		due, err := parseDueDate(b.DueDate, loc)
+		if err != nil {
+			errs["due_date"] = err.Error()
+		} else {
+			req.DueDate = &due
+		}
+	}
+
+	return req, errs
+}
+
+func (b updateTaskBody) validate() (service.UpdateTaskRequest, fieldErrors) {
+	errs := fieldErrors{}
+	req := service.UpdateTaskRequest{
+		Title:       b.Title,
+		Description: b.Description,
+		Done:        b.Done,
+	}
+
+	if b.Title != nil && *b.Title == "" {
+		errs["title"] = "must not be empty"
+	}
+
+	loc, err := loadLocation(b.Timezone)
+	if err != nil {
+		errs["timezone"] = err.Error()
+	} else if b.DueDate != nil {
+		if *b.DueDate == "" {
+			req.ClearDueDate = true
+		} else if due, err := parseDueDate(*b.DueDate, loc); err != nil {
+			errs["due_date"] = err.Error()
+		} else {
+			req.DueDate = &due
+		}
+	}
+
+	return req, errs
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errInvalidTimezone
+	}
+	return loc, nil
+}
+
+// parseDueDate accepts an RFC 3339 timestamp or a date. A date means the
+// end of that day in loc.
+func parseDueDate(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, errInvalidDate
+	}
+	return d.Add(24*time.Hour - time.Second), nil
+}
+
+// parseDateParam parses a query parameter bound. A date means the start of
+// that day in UTC.
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, errInvalidDate
+	}
+	return d, nil
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"pz1.2/services/tasks/internal/webhook"
+	"pz1.2/shared/middleware"
+	"pz1.2/shared/problem"
+)
+
+const minWebhookSecretLen = 16
+
+type createWebhookBody struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+func (b createWebhookBody) validate() fieldErrors {
+	errs := fieldErrors{}
+
+	if u, err := url.Parse(b.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs["url"] = "must be an absolute http or https URL"
+	}
+
+	if len(b.Events) == 0 {
+		errs["events"] = "must list at least one event type"
+	}
+	for _, e := range b.Events {
+		switch e {
+		case webhook.EventCreated, webhook.EventUpdated, webhook.EventCompleted, webhook.EventDeleted:
+		default:
+			errs["events"] = "must be created, updated, completed or deleted"
+		}
+	}
+
+	if len(b.Secret) < minWebhookSecretLen {
+		errs["secret"] = "must be at least 16 characters"
+	}
+
+	return errs
+}
+
+func (h *Handler) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetRequestID(r.Context())
+	log.Printf("[%s] Creating webhook", requestID)
+
+	var body createWebhookBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	errs := body.validate()
+	if _, ok := errs["url"]; !ok {
+		if err := h.destinations.CheckURL(r.Context(), body.URL); err != nil {
+			log.Printf("[%s] Webhook destination rejected: %v", requestID, err)
+			errs["url"] = "must not point to a loopback, private or link-local address"
+		}
+	}
+	if len(errs) > 0 {
+		problem.Write(w, r, problem.Validation(errs))
+		return
+	}
+
+	caller := callerFromRequest(r)
+	sub := h.webhooks.Create(caller.Subject, caller.Admin, body.URL, body.Events, body.Secret)
+
+	log.Printf("[%s] Webhook created: %s -> %s", requestID, sub.ID, sub.URL)
+	h.respondJSON(w, http.StatusCreated, sub)
+}
+
+func (h *Handler) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs := h.webhooks.List(callerFromRequest(r).Subject)
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{"items": subs})
+}
+
+func (h *Handler) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.webhooks.Get(callerFromRequest(r).Subject, r.PathValue("id"))
+	if err != nil {
+		h.respondWebhookError(w, r, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, sub)
+}
+
+func (h *Handler) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetRequestID(r.Context())
+	id := r.PathValue("id")
+	log.Printf("[%s] Deleting webhook: %s", requestID, id)
+
+	if err := h.webhooks.Delete(callerFromRequest(r).Subject, id); err != nil {
+		h.respondWebhookError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	attempts, err := h.webhooks.Deliveries(callerFromRequest(r).Subject, r.PathValue("id"))
+	if err != nil {
+		h.respondWebhookError(w, r, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{"items": attempts})
+}
+
+func (h *Handler) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters := h.webhooks.DeadLetters(callerFromRequest(r).Subject)
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{"items": letters})
+}
+
+func (h *Handler) respondWebhookError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, webhook.ErrNotFound) {
+		problem.Error(w, r, http.StatusNotFound, "webhook not found")
+		return
+	}
+	h.respondError(w, r, err)
+}
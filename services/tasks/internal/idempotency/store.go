@@ -0,0 +1,107 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const pruneInterval = time.Minute
+
+var (
+	ErrKeyReused  = errors.New("idempotency key reused with a different request")
+	ErrInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+// Response is a stored response replayed for retries of the same request.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	fingerprint string
+	response    *Response
+	expiresAt   time.Time
+}
+
+// Store remembers, per caller and idempotency key, the fingerprint of the
+// first request and the response it got, for ttl after it completed.
+type Store struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastPrune time.Time
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		ttl:       ttl,
+		entries:   make(map[string]*entry),
+		lastPrune: time.Now(),
+	}
+}
+
+// Begin reserves the key for a new request. It returns the stored response
+// if the same request has already completed, ErrKeyReused if the key was
+// used for a different request and ErrInProgress if the first request with
+// this key has not finished yet. A nil response and error mean the caller
+// must process the request and then call Complete or Abort.
+func (s *Store) Begin(scope, key, fingerprint string) (*Response, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPrune) > pruneInterval {
+		s.pruneLocked(now)
+	}
+
+	id := scope + "\x00" + key
+	if e, ok := s.entries[id]; ok && (e.response == nil || now.Before(e.expiresAt)) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, ErrKeyReused
+		case e.response == nil:
+			return nil, ErrInProgress
+		default:
+			return e.response, nil
+		}
+	}
+
+	s.entries[id] = &entry{fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *Store) Complete(scope, key string, resp *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[scope+"\x00"+key]; ok {
+		e.response = resp
+		e.expiresAt = time.Now().Add(s.ttl)
+	}
+}
+
+// Abort releases a reservation made by Begin, so the request can be retried.
+func (s *Store) Abort(scope, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := scope + "\x00" + key
+	if e, ok := s.entries[id]; ok && e.response == nil {
+		delete(s.entries, id)
+	}
+}
+
+func (s *Store) pruneLocked(now time.Time) {
+	for id, e := range s.entries {
+		if e.response != nil && now.After(e.expiresAt) {
+			delete(s.entries, id)
+		}
+	}
+	s.lastPrune = now
+}
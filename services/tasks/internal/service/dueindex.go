@@ -0,0 +1,72 @@
+package service
+
+import (
+	"sort"
+	"time"
+)
+
+type dueEntry struct {
+	due time.Time
+	id  string
+}
+
+// dueIndex keeps the IDs of tasks with a due date ordered by that date
+// (then by ID), so range queries do not have to scan every task.
+type dueIndex struct {
+	entries []dueEntry
+}
+
+func (idx *dueIndex) less(a, b dueEntry) bool {
+	if !a.due.Equal(b.due) {
+		return a.due.Before(b.due)
+	}
+	return a.id < b.id
+}
+
+func (idx *dueIndex) search(e dueEntry) int {
+	return sort.Search(len(idx.entries), func(i int) bool {
+		return !idx.less(idx.entries[i], e)
+	})
+}
+
+func (idx *dueIndex) add(id string, due *time.Time) {
+	if due == nil {
+		return
+	}
+	e := dueEntry{due: *due, id: id}
+	i := idx.search(e)
+	idx.entries = append(idx.entries, dueEntry{})
+	copy(idx.entries[i+1:], idx.entries[i:])
+	idx.entries[i] = e
+}
+
+func (idx *dueIndex) remove(id string, due *time.Time) {
+	if due == nil {
+		return
+	}
+	e := dueEntry{due: *due, id: id}
+	i := idx.search(e)
+	if i < len(idx.entries) && idx.entries[i].due.Equal(e.due) && idx.entries[i].id == e.id {
+		idx.entries = append(idx.entries[:i], idx.entries[i+1:]...)
+	}
+}
+
+// between returns the IDs of tasks due in [from, to), in due date order.
+// A zero from means no lower bound.
+func (idx *dueIndex) between(from, to time.Time) []string {
+	start := 0
+	if !from.IsZero() {
+		start = sort.Search(len(idx.entries), func(i int) bool {
+			return !idx.entries[i].due.Before(from)
+		})
+	}
+
+	var ids []string
+	for _, e := range idx.entries[start:] {
+		if !e.due.Before(to) {
+			break
+		}
+		ids = append(ids, e.id)
+	}
+	return ids
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+
+	// eventBacklog is how many recent events are kept for resuming watchers.
+	eventBacklog = 1000
+	// subscriberBuffer is how far a watcher may fall behind before it is
+	// disconnected; it can then resume from its last event.
+	subscriberBuffer = 64
+)
+
+// ErrEventsExpired means the requested event is no longer in the backlog
+// (or comes from an earlier run), so the watcher must re-list the tasks.
+var ErrEventsExpired = errors.New("events expired")
+
+// ErrInvalidEventID means the event id to resume after is malformed.
+var ErrInvalidEventID = errors.New("invalid event id")
+
+// Event describes a change to a task. Task holds the task after the change
+// and is nil for deletions. Completed marks the update that set done.
+// IDs have the form <epoch>-<seq>, where the epoch identifies the process
+// that published the event.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	TaskID    string    `json:"task_id"`
+	Owner     string    `json:"owner"`
+	Version   int64     `json:"version"`
+	Completed bool      `json:"completed,omitempty"`
+	Task      *Task     `json:"task,omitempty"`
+	Time      time.Time `json:"time"`
+
+	seq int64
+}
+
+// Subscription delivers the events visible to one caller. Backlog holds
+// the events missed since the requested event; Events is closed when the
+// subscriber falls behind or the service stops watching.
+type Subscription struct {
+	Backlog []Event
+	Events  <-chan Event
+
+	bus *eventBus
+	sub *subscriber
+}
+
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s.sub)
+}
+
+type subscriber struct {
+	caller Caller
+	ch     chan Event
+}
+
+// eventBus fans task events out to subscribers and keeps the most recent
+// ones so that a subscriber can resume after a disconnect.
+type eventBus struct {
+	mu      sync.Mutex
+	epoch   string
+	lastSeq int64
+	backlog []Event
+	subs    map[*subscriber]struct{}
+	closed  bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs:  make(map[*subscriber]struct{}),
+	}
+}
+
+func (b *eventBus) publish(eventType string, task *Task, completed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastSeq++
+	event := Event{
+		ID:        fmt.Sprintf("%s-%d", b.epoch, b.lastSeq),
+		Type:      eventType,
+		TaskID:    task.ID,
+		Owner:     task.Owner,
+		Version:   task.Version,
+		Completed: completed,
+		Time:      time.Now().UTC(),
+		seq:       b.lastSeq,
+	}
+	if eventType != EventDeleted {
+		t := *task
+		event.Task = &t
+	}
+
+	b.backlog = append(b.backlog, event)
+	if len(b.backlog) > eventBacklog {
+		b.backlog = b.backlog[len(b.backlog)-eventBacklog:]
+	}
+
+	for sub := range b.subs {
+		if !sub.caller.canSee(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			b.dropLocked(sub)
+		}
+	}
+}
+
+// subscribe registers a subscriber. A non-empty afterID asks for the events
+// after it as well.
+func (b *eventBus) subscribe(caller Caller, afterID string) (*Subscription, error) {
+	var epoch string
+	var afterSeq int64
+	if afterID != "" {
+		var err error
+		if epoch, afterSeq, err = parseEventID(afterID); err != nil {
+			return nil, err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Event
+	if afterID != "" {
+		if epoch != b.epoch || afterSeq > b.lastSeq || (len(b.backlog) > 0 && afterSeq < b.backlog[0].seq-1) {
+			return nil, ErrEventsExpired
+		}
+		for _, event := range b.backlog {
+			if event.seq > afterSeq && caller.canSee(event) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	sub := &subscriber{caller: caller, ch: make(chan Event, subscriberBuffer)}
+	if b.closed {
+		close(sub.ch)
+	} else {
+		b.subs[sub] = struct{}{}
+	}
+
+	return &Subscription{Backlog: backlog, Events: sub.ch, bus: b, sub: sub}, nil
+}
+
+func parseEventID(id string) (string, int64, error) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch == "" {
+		return "", 0, ErrInvalidEventID
+	}
+	n, err := strconv.ParseInt(seq, 10, 64)
+	if err != nil || n <= 0 {
+		return "", 0, ErrInvalidEventID
+	}
+	return epoch, n, nil
+}
+
+func (b *eventBus) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dropLocked(sub)
+}
+
+func (b *eventBus) dropLocked(sub *subscriber) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.dropLocked(sub)
+	}
+}
+
+func (c Caller) canSee(event Event) bool {
+	return c.Admin || event.Owner == c.Subject
+}
+
+// Watch subscribes the caller to changes of the tasks they can access. A
+// non-empty lastEventID resumes after that event.
+func (s *TaskService) Watch(caller Caller, lastEventID string) (*Subscription, error) {
+	return s.events.subscribe(caller, lastEventID)
+}
+
+// StopWatchers ends every subscription, e.g. before shutting down.
+func (s *TaskService) StopWatchers() {
+	s.events.close()
+}
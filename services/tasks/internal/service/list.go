@@ -0,0 +1,206 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SortCreatedAt = "created_at"
+	SortDueDate   = "due_date"
+	SortTitle     = "title"
+
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+
+	// sortTimeLayout is fixed-width, so formatted UTC times order
+	// lexicographically.
+	sortTimeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type ListOptions struct {
+	Limit     int
+	Cursor    string
+	Done      *bool
+	DueBefore time.Time
+	DueAfter  time.Time
+	// Overdue selects open tasks whose due date has passed (true) or all
+	// other tasks (false).
+	Overdue *bool
+	Query   string
+	Sort    string
+	Desc    bool
+}
+
+type TaskPage struct {
+	Items      []*Task `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// cursor points at the last item of the previous page. It also records the
+// ordering it was issued for, so it cannot be reused with another one.
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func (s *TaskService) GetAll(caller Caller, opts ListOptions) (*TaskPage, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortCreatedAt
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultPageLimit
+	}
+	if opts.Limit > MaxPageLimit {
+		opts.Limit = MaxPageLimit
+	}
+
+	var after *cursor
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil || c.Sort != opts.Sort || c.Desc != opts.Desc {
+			return nil, ErrInvalidCursor
+		}
+		after = c
+	}
+
+	now := time.Now()
+
+	var (
+		all []*Task
+		err error
+	)
+	if opts.Overdue != nil && *opts.Overdue {
+		all, err = s.openTasksDue(caller, time.Time{}, now)
+	} else {
+		all, err = s.repo.List()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*Task, 0, len(all))
+	for _, task := range all {
+		if caller.canAccess(task) && opts.matches(task, now) {
+			tasks = append(tasks, task)
+		}
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return opts.compare(sortValue(tasks[i], opts.Sort), tasks[i].ID, sortValue(tasks[j], opts.Sort), tasks[j].ID) < 0
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(tasks), func(i int) bool {
+			return opts.compare(sortValue(tasks[i], opts.Sort), tasks[i].ID, after.Value, after.ID) > 0
+		})
+	}
+
+	end := start + opts.Limit
+	if end > len(tasks) {
+		end = len(tasks)
+	}
+
+	page := &TaskPage{Items: tasks[start:end]}
+	if end < len(tasks) {
+		last := tasks[end-1]
+		page.NextCursor = encodeCursor(cursor{
+			Sort:  opts.Sort,
+			Desc:  opts.Desc,
+			Value: sortValue(last, opts.Sort),
+			ID:    last.ID,
+		})
+	}
+	return page, nil
+}
+
+func (o ListOptions) matches(task *Task, now time.Time) bool {
+	if o.Done != nil && task.Done != *o.Done {
+		return false
+	}
+	if !o.DueBefore.IsZero() && (task.DueDate == nil || !task.DueDate.Before(o.DueBefore)) {
+		return false
+	}
+	if !o.DueAfter.IsZero() && (task.DueDate == nil || !task.DueDate.After(o.DueAfter)) {
+		return false
+	}
+	if o.Overdue != nil && *o.Overdue != task.overdue(now) {
+		return false
+	}
+	if o.Query != "" {
+		q := strings.ToLower(o.Query)
+		if !strings.Contains(strings.ToLower(task.Title), q) &&
+			!strings.Contains(strings.ToLower(task.Description), q) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare orders tasks by the sort value, then by ID. Tasks without a value
+// (no due date) always go last, whatever the direction.
+func (o ListOptions) compare(aValue, aID, bValue, bID string) int {
+	if (aValue == "") != (bValue == "") {
+		if aValue == "" {
+			return 1
+		}
+		return -1
+	}
+
+	c := strings.Compare(aValue, bValue)
+	if o.Sort == SortTitle {
+		c = strings.Compare(strings.ToLower(aValue), strings.ToLower(bValue))
+	}
+	if c == 0 {
+		c = strings.Compare(aID, bID)
+	}
+	if o.Desc {
+		c = -c
+	}
+	return c
+}
+
+func (t *Task) overdue(now time.Time) bool {
+	return !t.Done && t.DueDate != nil && t.DueDate.Before(now)
+}
+
+func sortValue(task *Task, field string) string {
+	switch field {
+	case SortDueDate:
+		if task.DueDate == nil {
+			return ""
+		}
+		return task.DueDate.UTC().Format(sortTimeLayout)
+	case SortTitle:
+		return task.Title
+	default:
+		return task.CreatedAt.UTC().Format(sortTimeLayout)
+	}
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
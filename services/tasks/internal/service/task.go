@@ -9,89 +9,166 @@ import (
 )
 
 var (
-	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskNotFound    = errors.New("task not found")
+	ErrVersionMismatch = errors.New("task version mismatch")
 )
 
 type Task struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description,omitempty"`
-	DueDate     string `json:"due_date,omitempty"`
-	Done        bool   `json:"done"`
-	CreatedAt   string `json:"created_at,omitempty"`
+	ID          string     `json:"id"`
+	Owner       string     `json:"owner"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	DueDate     *time.Time `json:"due_date,omitempty"`
+	Done        bool       `json:"done"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Version     int64      `json:"version"`
 }
 
 type CreateTaskRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	DueDate     string `json:"due_date"`
+	Title       string
+	Description string
+	DueDate     *time.Time
 }
 
 type UpdateTaskRequest struct {
-	Title       *string `json:"title,omitempty"`
-	Description *string `json:"description,omitempty"`
-	DueDate     *string `json:"due_date,omitempty"`
-	Done        *bool   `json:"done,omitempty"`
+	Title       *string
+	Description *string
+	DueDate     *time.Time
+	// ClearDueDate removes the due date; DueDate is ignored then.
+	ClearDueDate bool
+	Done         *bool
+}
+
+// TaskRepository stores tasks. Implementations must be safe for concurrent
+// use and must not retain or hand out pointers shared with callers.
+type TaskRepository interface {
+	Create(task *Task) error
+	Get(id string) (*Task, error)
+	List() ([]*Task, error)
+	Update(task *Task) error
+	Delete(id string) error
+}
+
+// Caller identifies who performs an operation. Admins see every task,
+// everyone else only their own.
+type Caller struct {
+	Subject string
+	Admin   bool
+}
+
+func (c Caller) canAccess(task *Task) bool {
+	return c.Admin || task.Owner == c.Subject
 }
 
 type TaskService struct {
-	mu    sync.RWMutex
-	tasks map[string]*Task
+	// mu serializes writes, so that the repository, the due date index and
+	// the order of events change together.
+	mu     sync.Mutex
+	repo   TaskRepository
+	due    dueIndex
+	events *eventBus
 }
 
-func NewTaskService() *TaskService {
-	return &TaskService{
-		tasks: make(map[string]*Task),
+func NewTaskService(repo TaskRepository) (*TaskService, error) {
+	tasks, err := repo.List()
+	if err != nil {
+		return nil, err
 	}
+
+	s := &TaskService{
+		repo:   repo,
+		events: newEventBus(),
+	}
+	for _, task := range tasks {
+		s.due.add(task.ID, task.DueDate)
+	}
+	return s, nil
 }
 
-func (s *TaskService) Create(req CreateTaskRequest) *Task {
+func (s *TaskService) Create(caller Caller, req CreateTaskRequest) (*Task, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	task := &Task{
 		ID:          "t_" + uuid.New().String()[:8],
+		Owner:       caller.Subject,
 		Title:       req.Title,
 		Description: req.Description,
 		DueDate:     req.DueDate,
 		Done:        false,
-		CreatedAt:   time.Now().Format(time.RFC3339),
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+		Version:     1,
 	}
 
-	s.tasks[task.ID] = task
-	return task
+	if err := s.repo.Create(task); err != nil {
+		return nil, err
+	}
+	s.due.add(task.ID, task.DueDate)
+	s.events.publish(EventCreated, task, false)
+	return task, nil
 }
 
-func (s *TaskService) GetAll() []*Task {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// DueWithin returns the caller's open tasks due between now and now+within,
+// soonest first.
+func (s *TaskService) DueWithin(caller Caller, within time.Duration) ([]*Task, error) {
+	now := time.Now()
+	return s.openTasksDue(caller, now, now.Add(within))
+}
 
-	tasks := make([]*Task, 0, len(s.tasks))
-	for _, task := range s.tasks {
-		tasks = append(tasks, task)
+// openTasksDue looks up the caller's tasks that are not done and are due in
+// [from, to) through the due date index.
+func (s *TaskService) openTasksDue(caller Caller, from, to time.Time) ([]*Task, error) {
+	s.mu.Lock()
+	ids := s.due.between(from, to)
+	s.mu.Unlock()
+
+	tasks := make([]*Task, 0, len(ids))
+	for _, id := range ids {
+		task, err := s.repo.Get(id)
+		if errors.Is(err, ErrTaskNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if caller.canAccess(task) && !task.Done {
+			tasks = append(tasks, task)
+		}
 	}
-	return tasks
+	return tasks, nil
 }
 
-func (s *TaskService) GetByID(id string) (*Task, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	task, ok := s.tasks[id]
-	if !ok {
+func (s *TaskService) GetByID(caller Caller, id string) (*Task, error) {
+	task, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.canAccess(task) {
 		return nil, ErrTaskNotFound
 	}
 	return task, nil
 }
 
-func (s *TaskService) Update(id string, req UpdateTaskRequest) (*Task, error) {
+// Update applies req to the task. A non-zero version makes the update
+// conditional: it fails with ErrVersionMismatch unless the task is still at
+// that version.
+func (s *TaskService) Update(caller Caller, id string, req UpdateTaskRequest, version int64) (*Task, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	task, ok := s.tasks[id]
-	if !ok {
+	task, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.canAccess(task) {
 		return nil, ErrTaskNotFound
 	}
+	if version != 0 && task.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	oldDue := task.DueDate
+	wasDone := task.Done
 
 	if req.Title != nil {
 		task.Title = *req.Title
@@ -99,24 +176,48 @@ func (s *TaskService) Update(id string, req UpdateTaskRequest) (*Task, error) {
 	if req.Description != nil {
 		task.Description = *req.Description
 	}
-	if req.DueDate != nil {
-		task.DueDate = *req.DueDate
+	if req.ClearDueDate {
+		task.DueDate = nil
+	} else if req.DueDate != nil {
+		task.DueDate = req.DueDate
 	}
 	if req.Done != nil {
 		task.Done = *req.Done
 	}
+	task.Version++
+	completed := !wasDone && task.Done
 
+	if err := s.repo.Update(task); err != nil {
+		return nil, err
+	}
+	s.due.remove(task.ID, oldDue)
+	s.due.add(task.ID, task.DueDate)
+	s.events.publish(EventUpdated, task, completed)
 	return task, nil
 }
 
-func (s *TaskService) Delete(id string) error {
+// Delete removes the task. A non-zero version makes it conditional, as in
+// Update.
+func (s *TaskService) Delete(caller Caller, id string, version int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.tasks[id]; !ok {
+	task, err := s.repo.Get(id)
+	if err != nil {
+		return err
+	}
+	if !caller.canAccess(task) {
 		return ErrTaskNotFound
 	}
+	if version != 0 && task.Version != version {
+		return ErrVersionMismatch
+	}
 
-	delete(s.tasks, id)
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	s.due.remove(task.ID, task.DueDate)
+	task.Version++
+	s.events.publish(EventDeleted, task, false)
 	return nil
 }
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// crashWriterEnv makes the test binary act as a writer that creates tasks
+// until it is killed.
+const crashWriterEnv = "STORAGE_CRASH_WRITER_DIR"
+
+// TestKilledWriterRecovers SIGKILLs a process that keeps appending, with a
+// snapshot every few records, and checks that every acknowledged task
+// survives and that the log accepts new records afterwards.
+func TestKilledWriterRecovers(t *testing.T) {
+	if dir := os.Getenv(crashWriterEnv); dir != "" {
+		runCrashWriter(dir)
+		return
+	}
+	if testing.Short() {
+		t.Skip("starts a subprocess")
+	}
+
+	dir := t.TempDir()
+	for round, kill := range []int{40, 25, 60, 33} {
+		acked := killWriterAfter(t, dir, kill)
+
+		r := openRepo(t, dir)
+		ids := taskIDs(t, r)
+		if len(ids) < acked {
+			t.Fatalf("round %d: recovered %d tasks, but %d were acknowledged", round, len(ids), acked)
+		}
+		for i, id := range ids {
+			if want := crashTaskID(i + 1); id != want {
+				t.Fatalf("round %d: task %d is %s, want %s", round, i, id, want)
+			}
+		}
+		crash(t, r)
+	}
+}
+
+// killWriterAfter starts a writer on dir, kills it once it has acknowledged
+// n more tasks and returns how many tasks were acknowledged in total.
+func killWriterAfter(t *testing.T, dir string, n int) int {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestKilledWriterRecovers$")
+	cmd.Env = append(os.Environ(), crashWriterEnv+"="+dir)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	acked, seen := 0, 0
+	scanner := bufio.NewScanner(stdout)
+	for seen < n && scanner.Scan() {
+		var i int
+		if _, err := fmt.Sscanf(scanner.Text(), "created %d", &i); err != nil {
+			continue
+		}
+		acked = i
+		seen++
+	}
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+
+	if seen < n {
+		t.Fatalf("writer acknowledged %d tasks before exiting, want %d", seen, n)
+	}
+	return acked
+}
+
+func runCrashWriter(dir string) {
+	r, err := NewFileRepository(dir, 7)
+	if err != nil {
+		fmt.Println("open:", err)
+		os.Exit(1)
+	}
+	tasks, err := r.List()
+	if err != nil {
+		fmt.Println("list:", err)
+		os.Exit(1)
+	}
+	for i := len(tasks) + 1; ; i++ {
+		if err := r.Create(newTask(crashTaskID(i), strings.Repeat("x", i%300))); err != nil {
+			fmt.Println("create:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("created %d\n", i)
+	}
+}
+
+func crashTaskID(i int) string {
+	return fmt.Sprintf("t_%05d", i)
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"pz1.2/services/tasks/internal/service"
+)
+
+const (
+	walFileName      = "tasks.wal"
+	snapshotFileName = "tasks.snapshot.json"
+
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// errTornRecord marks a log line that fails its checksum, i.e. one that
+// was only partly written when the process died.
+var errTornRecord = errors.New("torn wal record")
+
+type walRecord struct {
+	Op   string        `json:"op"`
+	Task *service.Task `json:"task,omitempty"`
+	ID   string        `json:"id,omitempty"`
+}
+
+// FileRepository keeps tasks in memory and makes every change durable by
+// appending it to a write-ahead log on disk before applying it. Each log
+// line is "<crc32 hex> <json record>", so a torn or corrupted tail left by a
+// crash is detected and cut off on recovery. Once the log holds
+// snapshotEvery records, the full state is written to a snapshot file and
+// the log is truncated.
+type FileRepository struct {
+	dir           string
+	snapshotEvery int
+
+	mu         sync.RWMutex
+	tasks      map[string]*service.Task
+	wal        *os.File
+	walSize    int64
+	walRecords int
+}
+
+func NewFileRepository(dir string, snapshotEvery int) (*FileRepository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+
+	r := &FileRepository{
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+		tasks:         make(map[string]*service.Task),
+	}
+
+	if err := r.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := r.replayWAL(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(r.walPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	r.wal = wal
+
+	log.Printf("Task storage recovered from %s: %d tasks, %d wal records", dir, len(r.tasks), r.walRecords)
+	return r, nil
+}
+
+func (r *FileRepository) Create(task *service.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.appendLocked(walRecord{Op: opPut, Task: task}); err != nil {
+		return err
+	}
+	r.tasks[task.ID] = clone(task)
+	r.maybeCompactLocked()
+	return nil
+}
+
+func (r *FileRepository) Get(id string) (*service.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[id]
+	if !ok {
+		return nil, service.ErrTaskNotFound
+	}
+	return clone(task), nil
+}
+
+func (r *FileRepository) List() ([]*service.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tasks := make([]*service.Task, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		tasks = append(tasks, clone(task))
+	}
+	return tasks, nil
+}
+
+func (r *FileRepository) Update(task *service.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tasks[task.ID]; !ok {
+		return service.ErrTaskNotFound
+	}
+	if err := r.appendLocked(walRecord{Op: opPut, Task: task}); err != nil {
+		return err
+	}
+	r.tasks[task.ID] = clone(task)
+	r.maybeCompactLocked()
+	return nil
+}
+
+func (r *FileRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tasks[id]; !ok {
+		return service.ErrTaskNotFound
+	}
+	if err := r.appendLocked(walRecord{Op: opDelete, ID: id}); err != nil {
+		return err
+	}
+	delete(r.tasks, id)
+	r.maybeCompactLocked()
+	return nil
+}
+
+// Close writes a final snapshot and closes the log.
+func (r *FileRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.compactLocked(); err != nil {
+		log.Printf("Task storage: final compaction failed: %v", err)
+	}
+	return r.wal.Close()
+}
+
+func (r *FileRepository) appendLocked(rec walRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode wal record: %w", err)
+	}
+
+	line := make([]byte, 0, len(payload)+10)
+	line = append(line, fmt.Sprintf("%08x ", crc32.ChecksumIEEE(payload))...)
+	line = append(line, payload...)
+	line = append(line, '\n')
+
+	if _, err := r.wal.Write(line); err != nil {
+		// Drop whatever part of the record made it to the file, so that the
+		// next append does not land after a torn line.
+		r.wal.Truncate(r.walSize)
+		return fmt.Errorf("write wal: %w", err)
+	}
+	if err := r.wal.Sync(); err != nil {
+		r.wal.Truncate(r.walSize)
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	r.walSize += int64(len(line))
+	r.walRecords++
+	return nil
+}
+
+func (r *FileRepository) maybeCompactLocked() {
+	if r.snapshotEvery <= 0 || r.walRecords < r.snapshotEvery {
+		return
+	}
+	if err := r.compactLocked(); err != nil {
+		log.Printf("Task storage: compaction failed, keeping wal: %v", err)
+	}
+}
+
+// compactLocked writes the current state to a new snapshot, atomically
+// replaces the old one and truncates the log. A crash before the rename
+// leaves the old snapshot and the full log; a crash after it replays
+// records that are already in the snapshot, which is harmless.
+func (r *FileRepository) compactLocked() error {
+	tasks := make([]*service.Task, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		tasks = append(tasks, task)
+	}
+
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(r.dir, snapshotFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("chmod snapshot: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.snapshotPath()); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+	if err := syncDir(r.dir); err != nil {
+		return err
+	}
+
+	if err := r.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	if err := r.wal.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	r.walSize = 0
+	r.walRecords = 0
+	return nil
+}
+
+func (r *FileRepository) loadSnapshot() error {
+	data, err := os.ReadFile(r.snapshotPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var tasks []*storedTask
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	for _, task := range tasks {
+		r.tasks[task.ID] = task.task()
+	}
+	return nil
+}
+
+// replayWAL applies the log on top of the snapshot. Replay stops at the
+// first incomplete line or checksum mismatch, and the file is truncated
+// there: such a line can only be the tail of a write interrupted by a
+// crash, and that write was never acknowledged. A line with a valid
+// checksum that cannot be decoded was acknowledged, so it is reported as an
+// error instead of being cut off together with everything after it.
+func (r *FileRepository) replayWAL() error {
+	f, err := os.OpenFile(r.walPath(), os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("Task storage: dropping incomplete wal record at offset %d", offset)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read wal: %w", err)
+		}
+
+		rec, err := decodeRecord(line)
+		if errors.Is(err, errTornRecord) {
+			log.Printf("Task storage: dropping corrupted wal tail at offset %d", offset)
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("wal record at offset %d: %w", offset, err)
+		}
+
+		switch rec.Op {
+		case opPut:
+			r.tasks[rec.Task.ID] = rec.Task
+		case opDelete:
+			delete(r.tasks, rec.ID)
+		}
+
+		offset += int64(len(line))
+		r.walRecords++
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	r.walSize = offset
+	return nil
+}
+
+func decodeRecord(line []byte) (walRecord, error) {
+	var rec walRecord
+	var stored struct {
+		Op   string      `json:"op"`
+		Task *storedTask `json:"task,omitempty"`
+		ID   string      `json:"id,omitempty"`
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	sum, payload, found := bytes.Cut(line, []byte(" "))
+	if !found {
+		return rec, errTornRecord
+	}
+
+	want, err := strconv.ParseUint(string(sum), 16, 32)
+	if err != nil || uint32(want) != crc32.ChecksumIEEE(payload) {
+		return rec, errTornRecord
+	}
+
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		return rec, fmt.Errorf("decode: %w", err)
+	}
+	rec = walRecord{Op: stored.Op, ID: stored.ID}
+	if stored.Task != nil {
+		rec.Task = stored.Task.task()
+	}
+	switch {
+	case rec.Op == opPut && rec.Task != nil && rec.Task.ID != "":
+	case rec.Op == opDelete && rec.ID != "":
+	default:
+		return rec, fmt.Errorf("invalid %q record", rec.Op)
+	}
+	return rec, nil
+}
+
+func (r *FileRepository) walPath() string {
+	return filepath.Join(r.dir, walFileName)
+}
+
+func (r *FileRepository) snapshotPath() string {
+	return filepath.Join(r.dir, snapshotFileName)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open data dir: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync data dir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"pz1.2/services/tasks/internal/service"
+)
+
+func newTask(id, title string) *service.Task {
+	return &service.Task{
+		ID:        id,
+		Owner:     "student",
+		Title:     title,
+		CreatedAt: time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC),
+		Version:   1,
+	}
+}
+
+func openRepo(t *testing.T, dir string) *FileRepository {
+	t.Helper()
+	r, err := NewFileRepository(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileRepository: %v", err)
+	}
+	return r
+}
+
+// crash closes the log without the final snapshot Close would write, as if
+// the process had been killed.
+func crash(t *testing.T, r *FileRepository) {
+	t.Helper()
+	if err := r.wal.Close(); err != nil {
+		t.Fatalf("close wal: %v", err)
+	}
+}
+
+func mustCreate(t *testing.T, r *FileRepository, task *service.Task) {
+	t.Helper()
+	if err := r.Create(task); err != nil {
+		t.Fatalf("Create %s: %v", task.ID, err)
+	}
+}
+
+func taskIDs(t *testing.T, r *FileRepository) []string {
+	t.Helper()
+	tasks, err := r.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	ids := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func walLine(t *testing.T, rec walRecord) []byte {
+	t.Helper()
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload))
+}
+
+func appendToWAL(t *testing.T, dir string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func walSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestTornLastLineIsDroppedAndAppendContinues(t *testing.T) {
+	dir := t.TempDir()
+
+	r := openRepo(t, dir)
+	mustCreate(t, r, newTask("t_1", "first"))
+	mustCreate(t, r, newTask("t_2", "second"))
+	crash(t, r)
+	size := walSize(t, dir)
+
+	// Killed in the middle of writing the third record.
+	line := walLine(t, walRecord{Op: opPut, Task: newTask("t_3", "third")})
+	appendToWAL(t, dir, line[:len(line)/2])
+
+	r = openRepo(t, dir)
+	if got, want := taskIDs(t, r), []string{"t_1", "t_2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tasks after recovery = %v, want %v", got, want)
+	}
+	if got := walSize(t, dir); got != size {
+		t.Fatalf("wal size after recovery = %d, want %d", got, size)
+	}
+
+	mustCreate(t, r, newTask("t_4", "fourth"))
+	crash(t, r)
+
+	r = openRepo(t, dir)
+	defer r.Close()
+	if got, want := taskIDs(t, r), []string{"t_1", "t_2", "t_4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tasks after second recovery = %v, want %v", got, want)
+	}
+}
+
+func TestChecksumMismatchIsDropped(t *testing.T) {
+	dir := t.TempDir()
+
+	r := openRepo(t, dir)
+	mustCreate(t, r, newTask("t_1", "first"))
+	crash(t, r)
+	size := walSize(t, dir)
+
+	line := walLine(t, walRecord{Op: opPut, Task: newTask("t_2", "second")})
+	line[len(line)-5] ^= 0x01
+	appendToWAL(t, dir, line)
+
+	r = openRepo(t, dir)
+	defer r.Close()
+	if got, want := taskIDs(t, r), []string{"t_1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tasks after recovery = %v, want %v", got, want)
+	}
+	if got := walSize(t, dir); got != size {
+		t.Fatalf("wal size after recovery = %d, want %d", got, size)
+	}
+}
+
+func TestUndecodableRecordIsAnError(t *testing.T) {
+	dir := t.TempDir()
+
+	r := openRepo(t, dir)
+	mustCreate(t, r, newTask("t_1", "first"))
+	crash(t, r)
+
+	// A record with a valid checksum was acknowledged; it must not be cut off.
+	payload := []byte(`{"op":"rename","id":"t_1"}`)
+	appendToWAL(t, dir, []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)))
+	next := walLine(t, walRecord{Op: opPut, Task: newTask("t_2", "second")})
+	appendToWAL(t, dir, next)
+	size := walSize(t, dir)
+
+	if _, err := NewFileRepository(dir, 0); err == nil {
+		t.Fatal("NewFileRepository succeeded, want error")
+	}
+	if got := walSize(t, dir); got != size {
+		t.Fatalf("wal size = %d, want it untouched at %d", got, size)
+	}
+}
+
+func TestCrashBetweenSnapshotAndTruncateReplaysWithoutDuplicates(t *testing.T) {
+	dir := t.TempDir()
+
+	r := openRepo(t, dir)
+	mustCreate(t, r, newTask("t_1", "first"))
+	mustCreate(t, r, newTask("t_2", "second"))
+	updated := newTask("t_1", "first, updated")
+	updated.Version = 2
+	if err := r.Update(updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete("t_2"); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, r, newTask("t_3", "third"))
+
+	wal, err := os.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Close writes the snapshot and truncates the log; putting the log back
+	// leaves the state of a crash right after the snapshot rename.
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, walFileName), wal, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r = openRepo(t, dir)
+	defer r.Close()
+	if got, want := taskIDs(t, r), []string{"t_1", "t_3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tasks after recovery = %v, want %v", got, want)
+	}
+	task, err := r.Get("t_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Title != "first, updated" || task.Version != 2 {
+		t.Fatalf("t_1 = %+v, want the updated version", task)
+	}
+}
+
+func TestCloseAndReopenRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	due := time.Date(2026, 1, 10, 23, 59, 59, 0, time.UTC)
+
+	want := []*service.Task{newTask("t_1", "first"), newTask("t_2", "second")}
+	want[0].Description = "with a due date"
+	want[0].DueDate = &due
+	want[1].Done = true
+
+	r := openRepo(t, dir)
+	for _, task := range want {
+		mustCreate(t, r, task)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := walSize(t, dir); got != 0 {
+		t.Fatalf("wal size after Close = %d, want 0", got)
+	}
+
+	r = openRepo(t, dir)
+	defer r.Close()
+	for _, task := range want {
+		got, err := r.Get(task.ID)
+		if err != nil {
+			t.Fatalf("Get %s: %v", task.ID, err)
+		}
+		if !reflect.DeepEqual(got, task) {
+			t.Fatalf("Get %s = %+v, want %+v", task.ID, got, task)
+		}
+	}
+}
+
+func TestLegacyDueDatesAreConverted(t *testing.T) {
+	dir := t.TempDir()
+
+	// Written before due_date was a timestamp.
+	snapshot := `[
+		{"id":"t_1","owner":"student","title":"date","due_date":"2026-01-10","done":false,"created_at":"2026-01-05T09:30:00Z","version":1},
+		{"id":"t_2","owner":"student","title":"free text","due_date":"whenever","done":false,"created_at":"2026-01-05T09:30:00Z","version":1}
+	]`
+	if err := os.WriteFile(filepath.Join(dir, snapshotFileName), []byte(snapshot), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var wal []byte
+	for _, payload := range []string{
+		`{"op":"put","task":{"id":"t_3","owner":"student","title":"timestamp","due_date":"2026-01-10T12:00:00+03:00","done":false,"created_at":"2026-01-05T09:30:00Z","version":1}}`,
+		`{"op":"put","task":{"id":"t_4","owner":"student","title":"date","due_date":"2024-01-01","done":false,"created_at":"2026-01-05T09:30:00Z","version":1}}`,
+		`{"op":"put","task":{"id":"t_5","owner":"student","title":"none","done":false,"created_at":"2026-01-05T09:30:00Z","version":1}}`,
+	} {
+		wal = append(wal, fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE([]byte(payload)), payload)...)
+	}
+	if err := os.WriteFile(filepath.Join(dir, walFileName), wal, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openRepo(t, dir)
+	defer r.Close()
+
+	if got, want := walSize(t, dir), int64(len(wal)); got != want {
+		t.Fatalf("wal size after recovery = %d, want %d", got, want)
+	}
+
+	want := map[string]*time.Time{
+		"t_1": ptr(time.Date(2026, 1, 10, 23, 59, 59, 0, time.UTC)),
+		"t_2": nil,
+		"t_3": ptr(time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC)),
+		"t_4": ptr(time.Date(2024, 1, 1, 23, 59, 59, 0, time.UTC)),
+		"t_5": nil,
+	}
+	for id, due := range want {
+		task, err := r.Get(id)
+		if err != nil {
+			t.Fatalf("Get %s: %v", id, err)
+		}
+		switch {
+		case due == nil && task.DueDate != nil:
+			t.Errorf("%s due date = %v, want none", id, task.DueDate)
+		case due != nil && (task.DueDate == nil || !task.DueDate.Equal(*due)):
+			t.Errorf("%s due date = %v, want %v", id, task.DueDate, due)
+		}
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"pz1.2/services/tasks/internal/service"
+)
+
+// storedTask decodes a task from the log or the snapshot. Files written
+// before due dates became timestamps hold due_date as free-form text such
+// as "2026-01-10" or "whenever"; those are converted by legacyDueDate.
+type storedTask struct {
+	service.Task
+	DueDate json.RawMessage `json:"due_date,omitempty"`
+}
+
+func (s *storedTask) task() *service.Task {
+	task := s.Task
+	task.DueDate = legacyDueDate(task.ID, s.DueDate)
+	return &task
+}
+
+// legacyDueDate reads an RFC 3339 timestamp as is and a date as the end of
+// that day in UTC, as the API does. Anything else is dropped.
+func legacyDueDate(id string, raw json.RawMessage) *time.Time {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		log.Printf("Task storage: dropping unreadable due date %s of task %s", raw, id)
+		return nil
+	}
+	if value == "" {
+		return nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t
+	}
+	if d, err := time.Parse("2006-01-02", value); err == nil {
+		d = d.Add(24*time.Hour - time.Second)
+		return &d
+	}
+	log.Printf("Task storage: dropping due date %q of task %s, it is not a date", value, id)
+	return nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"sync"
+
+	"pz1.2/services/tasks/internal/service"
+)
+
+type MemoryRepository struct {
+	mu    sync.RWMutex
+	tasks map[string]*service.Task
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		tasks: make(map[string]*service.Task),
+	}
+}
+
+func (r *MemoryRepository) Create(task *service.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tasks[task.ID] = clone(task)
+	return nil
+}
+
+func (r *MemoryRepository) Get(id string) (*service.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[id]
+	if !ok {
+		return nil, service.ErrTaskNotFound
+	}
+	return clone(task), nil
+}
+
+func (r *MemoryRepository) List() ([]*service.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tasks := make([]*service.Task, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		tasks = append(tasks, clone(task))
+	}
+	return tasks, nil
+}
+
+func (r *MemoryRepository) Update(task *service.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tasks[task.ID]; !ok {
+		return service.ErrTaskNotFound
+	}
+	r.tasks[task.ID] = clone(task)
+	return nil
+}
+
+func (r *MemoryRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tasks[id]; !ok {
+		return service.ErrTaskNotFound
+	}
+	delete(r.tasks, id)
+	return nil
+}
+
+func clone(task *service.Task) *service.Task {
+	c := *task
+	if task.DueDate != nil {
+		due := *task.DueDate
+		c.DueDate = &due
+	}
+	return &c
+}
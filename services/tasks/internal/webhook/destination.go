@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenDestination means a webhook URL resolves to an address the
+// service must not call on behalf of users.
+var ErrForbiddenDestination = errors.New("webhook destination is not allowed")
+
+const resolveTimeout = 2 * time.Second
+
+// Destinations decides where webhooks may be delivered. Loopback, private,
+// link-local, multicast and unspecified addresses are refused unless the
+// host name or address is on the allowlist.
+type Destinations struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+}
+
+// NewDestinations builds the policy from allowlist entries: host names,
+// IP addresses or CIDR ranges.
+func NewDestinations(allowed []string) (*Destinations, error) {
+	d := &Destinations{hosts: make(map[string]bool)}
+	for _, entry := range allowed {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("allowed host %q: %w", entry, err)
+			}
+			d.networks = append(d.networks, network)
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			d.networks = append(d.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		default:
+			d.hosts[strings.ToLower(entry)] = true
+		}
+	}
+	return d, nil
+}
+
+// CheckURL rejects URLs whose host is, or resolves to, a forbidden address.
+// A name that cannot be resolved yet is accepted; it is checked again when
+// the delivery connects.
+func (d *Destinations) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if d.hostAllowed(host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return d.checkIP(ip)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := d.checkIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialContext connects like net.Dialer but refuses forbidden addresses after
+// name resolution, so a host cannot be re-pointed after registration.
+func (d *Destinations) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if d.hostAllowed(host) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		checked := *dialer
+		checked.Control = func(_, address string, _ syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipStr)
+			if ip == nil {
+				return ErrForbiddenDestination
+			}
+			return d.checkIP(ip)
+		}
+		return checked.DialContext(ctx, network, addr)
+	}
+}
+
+func (d *Destinations) hostAllowed(host string) bool {
+	return d.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
+
+func (d *Destinations) checkIP(ip net.IP) error {
+	for _, network := range d.networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrForbiddenDestination, ip)
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"pz1.2/services/tasks/internal/service"
+	"pz1.2/shared/metrics"
+
+	"github.com/google/uuid"
+)
+
+var deliveriesDropped = metrics.NewCounterVec("webhook_deliveries_dropped_total",
+	"Webhook deliveries moved to dead letters because the delivery queue was full.")
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	maxBackoff = 10 * time.Minute
+	// deliveryWorkers is how many deliveries are attempted at once.
+	deliveryWorkers = 8
+	// defaultQueueSize bounds the deliveries queued or waiting for a retry.
+	defaultQueueSize = 1000
+	// resubscribeDelay spaces out attempts to re-attach to the event bus.
+	resubscribeDelay = 100 * time.Millisecond
+)
+
+type Config struct {
+	// MaxAttempts is how many times a delivery is tried before it goes to
+	// the dead-letter list.
+	MaxAttempts int
+	// RetryBase is the delay before the first retry; it doubles after
+	// every failed attempt.
+	RetryBase time.Duration
+	Timeout   time.Duration
+	// QueueSize bounds the deliveries that are queued or waiting for a
+	// retry; further ones go straight to the dead letters. Zero means
+	// defaultQueueSize.
+	QueueSize int
+	// Destinations limits where deliveries may connect; nil allows only
+	// public addresses.
+	Destinations *Destinations
+}
+
+// Payload is the JSON body POSTed to subscribers.
+type Payload struct {
+	DeliveryID string        `json:"delivery_id"`
+	Event      string        `json:"event"`
+	EventID    string        `json:"event_id"`
+	TaskID     string        `json:"task_id"`
+	Version    int64         `json:"version"`
+	Task       *service.Task `json:"task,omitempty"`
+	Time       time.Time     `json:"time"`
+}
+
+// Dispatcher watches task events and delivers them to the matching
+// subscriptions.
+type Dispatcher struct {
+	tasks  *service.TaskService
+	store  *Store
+	cfg    Config
+	client *http.Client
+
+	// queue feeds the workers; pending holds a slot for every delivery
+	// until it succeeds or is dead-lettered, so the queue never fills up.
+	queue   chan *delivery
+	pending chan struct{}
+	active  sync.WaitGroup
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// delivery is one payload on its way to one subscription.
+type delivery struct {
+	sub     *Subscription
+	payload Payload
+	body    []byte
+	attempt int
+	lastErr string
+}
+
+func NewDispatcher(tasks *service.TaskService, store *Store, cfg Config) *Dispatcher {
+	destinations := cfg.Destinations
+	if destinations == nil {
+		destinations, _ = NewDestinations(nil)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would hide the real destination from the dial-time check.
+	transport.Proxy = nil
+	transport.DialContext = destinations.dialContext(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		tasks:   tasks,
+		store:   store,
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		queue:   make(chan *delivery, cfg.QueueSize),
+		pending: make(chan struct{}, cfg.QueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	d.workers.Add(deliveryWorkers)
+	for i := 0; i < deliveryWorkers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// Sign returns the signature of body sent at timestamp:
+// hex(HMAC-SHA256(secret, timestamp + "." + body)).
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run consumes task events until Stop is called. If the dispatcher falls
+// behind the event bus, it resumes after the last event it saw.
+func (d *Dispatcher) Run() {
+	var lastID string
+	admin := service.Caller{Admin: true}
+
+	for {
+		sub, err := d.tasks.Watch(admin, lastID)
+		if errors.Is(err, service.ErrEventsExpired) {
+			log.Printf("[webhook] Missed task events after %s, continuing with new ones", lastID)
+			lastID = ""
+			continue
+		}
+		if err != nil {
+			log.Printf("[webhook] Cannot watch task events: %v", err)
+			return
+		}
+
+		for _, event := range sub.Backlog {
+			d.dispatch(event)
+			lastID = event.ID
+		}
+		for event := range sub.Events {
+			d.dispatch(event)
+			lastID = event.ID
+		}
+		sub.Close()
+
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// Stop cancels queued deliveries and pending retries and waits for
+// in-flight attempts.
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	d.workers.Wait()
+}
+
+func (d *Dispatcher) dispatch(event service.Event) {
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	types := []string{event.Type}
+	if event.Completed {
+		types = append(types, EventCompleted)
+	}
+
+	for _, eventType := range types {
+		for _, sub := range d.store.matching(eventType, event.Owner) {
+			payload := Payload{
+				DeliveryID: "dl_" + uuid.New().String()[:8],
+				Event:      eventType,
+				EventID:    event.ID,
+				TaskID:     event.TaskID,
+				Version:    event.Version,
+				Task:       event.Task,
+				Time:       event.Time,
+			}
+			body, err := json.Marshal(payload)
+			if err != nil {
+				log.Printf("[webhook] Cannot encode event %s: %v", event.ID, err)
+				continue
+			}
+
+			d.enqueue(&delivery{sub: sub, payload: payload, body: body})
+		}
+	}
+}
+
+// enqueue queues a new delivery, or dead-letters it if too many deliveries
+// are already queued or waiting for a retry.
+func (d *Dispatcher) enqueue(dl *delivery) {
+	select {
+	case d.pending <- struct{}{}:
+	default:
+		deliveriesDropped.Inc()
+		log.Printf("[webhook] Delivery queue full, dropping %s", dl.payload.DeliveryID)
+		dl.lastErr = "delivery queue full"
+		d.deadLetter(dl)
+		return
+	}
+	d.active.Add(1)
+	d.queue <- dl
+}
+
+func (d *Dispatcher) done() {
+	<-d.pending
+	d.active.Done()
+}
+
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case dl := <-d.queue:
+			d.deliver(dl)
+		}
+	}
+}
+
+// deliver makes the next attempt of dl. A failed delivery is queued again
+// after a backoff until the attempts run out or the dispatcher stops.
+func (d *Dispatcher) deliver(dl *delivery) {
+	dl.attempt++
+	a := d.attempt(dl.sub, dl.payload, dl.body)
+	a.Attempt = dl.attempt
+	d.store.recordAttempt(dl.sub.ID, a)
+	if a.Success {
+		d.done()
+		return
+	}
+	dl.lastErr = a.Error
+	log.Printf("[webhook] Delivery %s to %s failed (attempt %d/%d): %s",
+		dl.payload.DeliveryID, dl.sub.URL, dl.attempt, d.cfg.MaxAttempts, dl.lastErr)
+
+	if dl.attempt >= d.cfg.MaxAttempts {
+		d.deadLetter(dl)
+		d.done()
+		return
+	}
+
+	backoff := d.cfg.RetryBase << (dl.attempt - 1)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	time.AfterFunc(backoff, func() {
+		if d.ctx.Err() != nil || !d.store.exists(dl.sub.ID) {
+			d.done()
+			return
+		}
+		d.queue <- dl
+	})
+}
+
+func (d *Dispatcher) deadLetter(dl *delivery) {
+	log.Printf("[webhook] Delivery %s to %s moved to dead letters", dl.payload.DeliveryID, dl.sub.URL)
+	d.store.addDeadLetter(dl.sub, DeadLetter{
+		DeliveryID:     dl.payload.DeliveryID,
+		SubscriptionID: dl.sub.ID,
+		URL:            dl.sub.URL,
+		Payload:        dl.body,
+		Attempts:       dl.attempt,
+		LastError:      dl.lastErr,
+		FailedAt:       time.Now().UTC(),
+	})
+}
+
+func (d *Dispatcher) attempt(sub *Subscription, payload Payload, body []byte) Attempt {
+	start := time.Now()
+	a := Attempt{
+		DeliveryID: payload.DeliveryID,
+		Event:      payload.Event,
+		TaskID:     payload.TaskID,
+		Time:       start.UTC(),
+	}
+
+	status, err := d.post(sub, payload, body)
+	a.Duration = time.Since(start).Round(time.Millisecond).String()
+	a.StatusCode = status
+	switch {
+	case err != nil:
+		a.Error = err.Error()
+	case status < 200 || status > 299:
+		a.Error = fmt.Sprintf("unexpected status %d", status)
+	default:
+		a.Success = true
+	}
+	return a
+}
+
+func (d *Dispatcher) post(sub *Subscription, payload Payload, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, payload.Event)
+	req.Header.Set(DeliveryHeader, payload.DeliveryID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(sub.secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return resp.StatusCode, nil
+}
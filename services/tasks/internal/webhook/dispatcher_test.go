@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pz1.2/services/tasks/internal/service"
+)
+
+const testSecret = "0123456789abcdef"
+
+// receiver records the requests it gets and answers with the next status
+// from statuses, repeating the last one.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, receivedRequest{header: r.Header.Clone(), body: body, at: time.Now()})
+	status := rc.statuses[len(rc.statuses)-1]
+	if len(rc.requests) <= len(rc.statuses) {
+		status = rc.statuses[len(rc.requests)-1]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []receivedRequest {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]receivedRequest(nil), rc.requests...)
+}
+
+func newTestDispatcher(t *testing.T, store *Store, maxAttempts int, allowed ...string) *Dispatcher {
+	t.Helper()
+	destinations, err := NewDestinations(allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(nil, store, Config{
+		MaxAttempts:  maxAttempts,
+		RetryBase:    20 * time.Millisecond,
+		Timeout:      time.Second,
+		Destinations: destinations,
+	})
+	t.Cleanup(d.Stop)
+	return d
+}
+
+func startReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	t.Helper()
+	rc := &receiver{statuses: statuses}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	return rc, srv.URL
+}
+
+func createdEvent() service.Event {
+	return service.Event{
+		ID:      "test-1",
+		Type:    service.EventCreated,
+		TaskID:  "t_001",
+		Owner:   "student",
+		Version: 1,
+		Task:    &service.Task{ID: "t_001", Owner: "student", Title: "Read lecture", Version: 1},
+		Time:    time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC),
+	}
+}
+
+// dispatchAndWait hands the event to the dispatcher and waits until every
+// delivery has succeeded or been dead-lettered.
+func dispatchAndWait(d *Dispatcher, event service.Event) {
+	d.dispatch(event)
+	d.active.Wait()
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	rc, url := startReceiver(t, http.StatusNoContent)
+	store := NewStore()
+	sub := store.Create("student", false, url, []string{EventCreated}, testSecret)
+	d := newTestDispatcher(t, store, 3, "127.0.0.1")
+
+	dispatchAndWait(d, createdEvent())
+
+	reqs := rc.received()
+	if len(reqs) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	timestamp := req.header.Get(TimestampHeader)
+	if got, want := req.header.Get(SignatureHeader), Sign(testSecret, timestamp, req.body); got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+	if got := req.header.Get(EventHeader); got != EventCreated {
+		t.Fatalf("event header = %q, want %q", got, EventCreated)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.EventID != "test-1" || payload.TaskID != "t_001" || payload.DeliveryID != req.header.Get(DeliveryHeader) {
+		t.Fatalf("payload = %+v", payload)
+	}
+
+	attempts, err := store.Deliveries("student", sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 1 || !attempts[0].Success || attempts[0].StatusCode != http.StatusNoContent {
+		t.Fatalf("delivery log = %+v, want one successful attempt", attempts)
+	}
+}
+
+func TestFailedDeliveryIsRetriedWithBackoff(t *testing.T) {
+	rc, url := startReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	store := NewStore()
+	sub := store.Create("student", false, url, []string{EventCreated}, testSecret)
+	d := newTestDispatcher(t, store, 5, "127.0.0.1")
+
+	dispatchAndWait(d, createdEvent())
+
+	reqs := rc.received()
+	if len(reqs) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(reqs))
+	}
+	for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := reqs[i+1].at.Sub(reqs[i].at); gap < want {
+			t.Fatalf("retry %d came after %v, want at least %v", i+1, gap, want)
+		}
+	}
+	if reqs[0].header.Get(DeliveryHeader) != reqs[2].header.Get(DeliveryHeader) {
+		t.Fatal("retries changed the delivery id")
+	}
+
+	attempts, err := store.Deliveries("student", sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 3 || !attempts[0].Success || attempts[0].Attempt != 3 || attempts[2].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("delivery log = %+v", attempts)
+	}
+	if letters := store.DeadLetters("student"); len(letters) != 0 {
+		t.Fatalf("dead letters = %+v, want none", letters)
+	}
+}
+
+func TestExhaustedDeliveryIsDeadLettered(t *testing.T) {
+	rc, url := startReceiver(t, http.StatusServiceUnavailable)
+	store := NewStore()
+	sub := store.Create("student", false, url, []string{EventCreated}, testSecret)
+	d := newTestDispatcher(t, store, 3, "127.0.0.1")
+
+	dispatchAndWait(d, createdEvent())
+
+	if got := len(rc.received()); got != 3 {
+		t.Fatalf("receiver got %d requests, want 3", got)
+	}
+	letters := store.DeadLetters("student")
+	if len(letters) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(letters))
+	}
+	letter := letters[0]
+	if letter.SubscriptionID != sub.ID || letter.Attempts != 3 || letter.LastError != "unexpected status 503" {
+		t.Fatalf("dead letter = %+v", letter)
+	}
+	var payload Payload
+	if err := json.Unmarshal(letter.Payload, &payload); err != nil || payload.TaskID != "t_001" {
+		t.Fatalf("dead letter payload = %s (%v)", letter.Payload, err)
+	}
+}
+
+func TestFullQueueDeadLettersDelivery(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+
+	store := NewStore()
+	store.Create("student", false, srv.URL, []string{EventCreated}, testSecret)
+	destinations, err := NewDestinations([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(nil, store, Config{
+		MaxAttempts:  1,
+		RetryBase:    time.Second,
+		Timeout:      5 * time.Second,
+		Destinations: destinations,
+		QueueSize:    1,
+	})
+	t.Cleanup(d.Stop)
+
+	// The first delivery holds the only queue slot while the receiver
+	// blocks, so the second one has nowhere to go.
+	d.dispatch(createdEvent())
+	d.dispatch(createdEvent())
+	letters := store.DeadLetters("student")
+	close(release)
+	d.active.Wait()
+
+	if len(letters) != 1 || letters[0].LastError != "delivery queue full" || letters[0].Attempts != 0 {
+		t.Fatalf("dead letters = %+v, want one dropped delivery", letters)
+	}
+	if got := len(store.DeadLetters("student")); got != 1 {
+		t.Fatalf("got %d dead letters after the first delivery finished, want 1", got)
+	}
+}
+
+func TestLoopbackDeliveryIsRefusedAtDial(t *testing.T) {
+	rc, url := startReceiver(t, http.StatusOK)
+	store := NewStore()
+	store.Create("student", false, url, []string{EventCreated}, testSecret)
+	d := newTestDispatcher(t, store, 1)
+
+	dispatchAndWait(d, createdEvent())
+
+	if got := len(rc.received()); got != 0 {
+		t.Fatalf("receiver got %d requests, want none", got)
+	}
+	letters := store.DeadLetters("student")
+	if len(letters) != 1 || !strings.Contains(letters[0].LastError, ErrForbiddenDestination.Error()) {
+		t.Fatalf("dead letters = %+v, want a refused destination", letters)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	destinations, err := NewDestinations([]string{"hooks.internal", "10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://10.1.2.3/hook", true},
+		{"http://hooks.internal/hook", true},
+	}
+	for _, tt := range tests {
+		err := destinations.CheckURL(context.Background(), tt.url)
+		if tt.allowed && err != nil {
+			t.Errorf("CheckURL(%s) = %v, want allowed", tt.url, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrForbiddenDestination) {
+			t.Errorf("CheckURL(%s) = %v, want ErrForbiddenDestination", tt.url, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types a subscription can ask for. Completed is sent for the update
+// that marks a task done, in addition to updated.
+const (
+	EventCreated   = "created"
+	EventUpdated   = "updated"
+	EventCompleted = "completed"
+	EventDeleted   = "deleted"
+
+	maxDeliveryLog = 100
+	maxDeadLetters = 1000
+)
+
+var ErrNotFound = errors.New("webhook not found")
+
+// Subscription asks for events of the given types to be POSTed to URL. Only
+// events for tasks the owner can access are delivered.
+type Subscription struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+
+	secret string
+	admin  bool
+}
+
+func (s *Subscription) wants(eventType string) bool {
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Attempt is one try to deliver an event, as shown in the delivery log.
+type Attempt struct {
+	DeliveryID string    `json:"delivery_id"`
+	Event      string    `json:"event"`
+	TaskID     string    `json:"task_id"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	Duration   string    `json:"duration"`
+	Time       time.Time `json:"time"`
+}
+
+// DeadLetter is a delivery that failed on every attempt.
+type DeadLetter struct {
+	DeliveryID     string          `json:"delivery_id"`
+	SubscriptionID string          `json:"subscription_id"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error"`
+	FailedAt       time.Time       `json:"failed_at"`
+
+	owner string
+}
+
+// Store keeps subscriptions, their recent delivery attempts and the dead
+// letters in memory.
+type Store struct {
+	mu          sync.Mutex
+	subs        map[string]*Subscription
+	deliveries  map[string][]Attempt
+	deadLetters []DeadLetter
+}
+
+func NewStore() *Store {
+	return &Store{
+		subs:       make(map[string]*Subscription),
+		deliveries: make(map[string][]Attempt),
+	}
+}
+
+func (s *Store) Create(owner string, admin bool, url string, events []string, secret string) *Subscription {
+	sub := &Subscription{
+		ID:        "wh_" + uuid.New().String()[:8],
+		Owner:     owner,
+		URL:       url,
+		Events:    events,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		secret:    secret,
+		admin:     admin,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[sub.ID] = sub
+	return sub
+}
+
+func (s *Store) List(owner string) []*Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := make([]*Subscription, 0)
+	for _, sub := range s.subs {
+		if sub.Owner == owner {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt) ||
+			subs[i].CreatedAt.Equal(subs[j].CreatedAt) && subs[i].ID < subs[j].ID
+	})
+	return subs
+}
+
+func (s *Store) Get(owner, id string) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.Owner != owner {
+		return nil, ErrNotFound
+	}
+	return sub, nil
+}
+
+func (s *Store) Delete(owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.Owner != owner {
+		return ErrNotFound
+	}
+	delete(s.subs, id)
+	delete(s.deliveries, id)
+	return nil
+}
+
+// Deliveries returns the recent delivery attempts of a subscription, newest
+// first.
+func (s *Store) Deliveries(owner, id string) ([]Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.Owner != owner {
+		return nil, ErrNotFound
+	}
+
+	log := s.deliveries[id]
+	attempts := make([]Attempt, len(log))
+	for i, a := range log {
+		attempts[len(log)-1-i] = a
+	}
+	return attempts, nil
+}
+
+func (s *Store) DeadLetters(owner string) []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters := make([]DeadLetter, 0)
+	for i := len(s.deadLetters) - 1; i >= 0; i-- {
+		if s.deadLetters[i].owner == owner {
+			letters = append(letters, s.deadLetters[i])
+		}
+	}
+	return letters
+}
+
+func (s *Store) matching(eventType string, owner string) []*Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var subs []*Subscription
+	for _, sub := range s.subs {
+		if sub.wants(eventType) && (sub.admin || sub.Owner == owner) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+func (s *Store) recordAttempt(subID string, a Attempt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subs[subID]; !ok {
+		return
+	}
+	log := append(s.deliveries[subID], a)
+	if len(log) > maxDeliveryLog {
+		log = log[len(log)-maxDeliveryLog:]
+	}
+	s.deliveries[subID] = log
+}
+
+func (s *Store) addDeadLetter(sub *Subscription, d DeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.owner = sub.Owner
+	s.deadLetters = append(s.deadLetters, d)
+	if len(s.deadLetters) > maxDeadLetters {
+		s.deadLetters = s.deadLetters[len(s.deadLetters)-maxDeadLetters:]
+	}
+}
+
+func (s *Store) exists(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.subs[id]
+	return ok
+}
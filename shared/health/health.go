@@ -0,0 +1,105 @@
+// Package health serves liveness and readiness endpoints.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a dependency the service needs is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health answers /livez as long as the process serves HTTP, and /readyz
+// while the service is not shutting down and every check passes.
+type Health struct {
+	shuttingDown atomic.Bool
+	checks       []namedCheck
+}
+
+func New() *Health {
+	return &Health{}
+}
+
+// AddCheck registers a readiness check. It must be called before the
+// routes are served.
+func (h *Health) AddCheck(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Shutdown makes readiness fail from now on, so that load balancers stop
+// sending new requests before the servers stop.
+func (h *Health) Shutdown() {
+	if !h.shuttingDown.Swap(true) {
+		log.Println("Readiness set to failing for shutdown")
+	}
+}
+
+func (h *Health) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /livez", h.handleLive)
+	mux.HandleFunc("GET /readyz", h.handleReady)
+}
+
+func (h *Health) handleLive(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, response{Status: "ok"})
+}
+
+func (h *Health) handleReady(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown.Load() {
+		respond(w, http.StatusServiceUnavailable, response{Status: "shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	resp := response{Status: "ok", Checks: make(map[string]string, len(h.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			result := "ok"
+			if err := c.check(ctx); err != nil {
+				result = err.Error()
+			}
+			mu.Lock()
+			resp.Checks[c.name] = result
+			if result != "ok" {
+				resp.Status = "unavailable"
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	respond(w, status, resp)
+}
+
+func respond(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -39,7 +39,10 @@ func (c *Client) Do(ctx context.Context, method, path string, body io.Reader) (*
 
 	req.Header.Set("Content-Type", "application/json")
 
-	return c.httpClient.Do(req)
+	req, span := middleware.TraceHTTPClient(req, method+" "+path)
+	resp, err := c.httpClient.Do(req)
+	middleware.FinishHTTPClient(span, resp, err)
+	return resp, err
 }
 
 func (c *Client) DoWithAuth(ctx context.Context, method, path, token string, body io.Reader) (*http.Response, error) {
@@ -58,5 +61,8 @@ func (c *Client) DoWithAuth(ctx context.Context, method, path, token string, bod
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	return c.httpClient.Do(req)
+	req, span := middleware.TraceHTTPClient(req, method+" "+path)
+	resp, err := c.httpClient.Do(req)
+	middleware.FinishHTTPClient(span, resp, err)
+	return resp, err
 }
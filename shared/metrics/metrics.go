@@ -0,0 +1,237 @@
+// Package metrics keeps counters and histograms in memory and serves them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds, the same as Prometheus client
+// libraries use by default.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var registry = struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}{metrics: make(map[string]metric)}
+
+func register(m metric) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.metrics[m.name()]; ok {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	registry.metrics[m.name()] = m
+}
+
+// Handler serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		WriteTo(bw)
+		bw.Flush()
+	})
+}
+
+// WriteTo writes all registered metrics sorted by name.
+func WriteTo(w io.Writer) {
+	registry.mu.Lock()
+	metrics := make([]metric, 0, len(registry.metrics))
+	for _, m := range registry.metrics {
+		metrics = append(metrics, m)
+	}
+	registry.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+type desc struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+}
+
+func (d *desc) name() string {
+	return d.metricName
+}
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, d.help, d.metricName, d.typ)
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats {a="x",b="y"}, appending extra as the last pair.
+func (d *desc) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escape(v)+`"`)
+		}
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+extra[1]+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{metricName: name, help: help, typ: "counter", labels: labels},
+		values: make(map[string]float64),
+	}
+	register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelPairs(key), formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{metricName: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(key, "le", formatFloat(upper)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(key, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelPairs(key), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelPairs(key), hist.count)
+	}
+}
+
+// funcMetric reads its value when metrics are scraped, for numbers that
+// are already tracked elsewhere.
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// NewCounterFunc registers a counter whose value is returned by fn.
+func NewCounterFunc(name, help string, fn func() float64) {
+	register(&funcMetric{desc: desc{metricName: name, help: help, typ: "counter"}, fn: fn})
+}
+
+// NewGaugeFunc registers a gauge whose value is returned by fn.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&funcMetric{desc: desc{metricName: name, help: help, typ: "gauge"}, fn: fn})
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	f.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", f.metricName, formatFloat(f.fn()))
+}
@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanExporter receives ended spans. ExportSpan must not block the caller
+// for long; Shutdown flushes whatever is still buffered.
+type SpanExporter interface {
+	ExportSpan(span *Span)
+	Shutdown(ctx context.Context) error
+}
+
+// NewSpanExporter returns the exporter named kind: "stdout", "otlp" (OTLP
+// over HTTP with JSON encoding, sent to endpoint) or "" / "none" for no
+// exporter.
+func NewSpanExporter(kind, service, endpoint string) (SpanExporter, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return NewStdoutExporter(service, nil), nil
+	case "otlp":
+		return NewOTLPExporter(service, endpoint), nil
+	}
+	return nil, fmt.Errorf("unknown span exporter %q", kind)
+}
+
+// StdoutExporter writes every span as one JSON line.
+type StdoutExporter struct {
+	service string
+	mu      sync.Mutex
+	enc     *json.Encoder
+}
+
+// NewStdoutExporter writes to w, or to os.Stdout if w is nil.
+func NewStdoutExporter(service string, w io.Writer) *StdoutExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &StdoutExporter{service: service, enc: json.NewEncoder(w)}
+}
+
+type stdoutSpan struct {
+	Service      string         `json:"service"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Name         string         `json:"name"`
+	Kind         string         `json:"kind"`
+	Start        time.Time      `json:"start"`
+	Duration     string         `json:"duration"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+func (e *StdoutExporter) ExportSpan(s *Span) {
+	out := stdoutSpan{
+		Service:      e.service,
+		TraceID:      s.TraceID,
+		SpanID:       s.SpanID,
+		ParentSpanID: s.ParentSpanID,
+		Name:         s.Name,
+		Kind:         s.Kind.String(),
+		Start:        s.Start,
+		Duration:     s.End.Sub(s.Start).String(),
+		Attributes:   s.Attributes,
+	}
+	if s.Error {
+		out.Error = s.StatusText
+		if out.Error == "" {
+			out.Error = "error"
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(out)
+}
+
+func (e *StdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+const (
+	otlpQueueSize     = 2048
+	otlpBatchSize     = 256
+	otlpFlushInterval = 2 * time.Second
+)
+
+// OTLPExporter batches spans and posts them to an OTLP/HTTP collector at
+// <endpoint>/v1/traces. Spans are dropped when the queue is full, so a slow
+// or missing collector never holds up requests.
+type OTLPExporter struct {
+	service    string
+	url        string
+	httpClient *http.Client
+
+	queue    chan *Span
+	done     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func NewOTLPExporter(service, endpoint string) *OTLPExporter {
+	if endpoint == "" {
+		endpoint = "http://localhost:4318"
+	}
+	e := &OTLPExporter{
+		service:    service,
+		url:        strings.TrimRight(endpoint, "/") + "/v1/traces",
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		queue:      make(chan *Span, otlpQueueSize),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *OTLPExporter) ExportSpan(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			log.Printf("OTLP export of %d spans failed: %v", len(batch), err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			for {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown sends the queued spans and stops the exporter.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.done) })
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) send(spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.httpClient.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The types below are the OTLP JSON encoding of ExportTraceServiceRequest.
+// IDs are hex strings and 64-bit integers are strings, as the encoding
+// requires.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+const otlpStatusError = 2
+
+func (e *OTLPExporter) encode(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		for k, v := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpAttribute(k, v))
+		}
+		if s.Error {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.StatusText}
+		}
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{otlpAttribute("service.name", e.service)}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "pz1.2/shared/middleware"},
+			Spans: out,
+		}},
+	}}}
+}
+
+func otlpAttribute(key string, value any) otlpKeyValue {
+	var v otlpAnyValue
+	switch x := value.(type) {
+	case int:
+		s := strconv.Itoa(x)
+		v.IntValue = &s
+	case bool:
+		v.BoolValue = &x
+	default:
+		s := fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"pz1.2/shared/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcServerHandled = metrics.NewCounterVec("grpc_server_handled_total",
+		"Unary RPCs completed on the server by service, method and code.", "grpc_service", "grpc_method", "grpc_code")
+	grpcServerHandling = metrics.NewHistogramVec("grpc_server_handling_seconds",
+		"Unary RPC latency on the server by service, method and code.", metrics.DefBuckets, "grpc_service", "grpc_method", "grpc_code")
+	grpcClientHandled = metrics.NewCounterVec("grpc_client_handled_total",
+		"Unary RPCs completed by the client by service, method and code.", "grpc_service", "grpc_method", "grpc_code")
+	grpcClientHandling = metrics.NewHistogramVec("grpc_client_handling_seconds",
+		"Unary RPC latency seen by the client by service, method and code.", metrics.DefBuckets, "grpc_service", "grpc_method", "grpc_code")
+)
+
+// UnaryServerMetrics records served unary RPCs.
+func UnaryServerMetrics() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeRPC(grpcServerHandled, grpcServerHandling, info.FullMethod, err, start)
+		return resp, err
+	}
+}
+
+// UnaryClientMetrics records unary RPCs made through a client connection.
+func UnaryClientMetrics() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		observeRPC(grpcClientHandled, grpcClientHandling, method, err, start)
+		return err
+	}
+}
+
+func observeRPC(handled *metrics.CounterVec, handling *metrics.HistogramVec, fullMethod string, err error, start time.Time) {
+	// fullMethod is /package.Service/Method.
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	code := status.Code(err).String()
+	handled.Inc(service, method, code)
+	handling.Observe(time.Since(start).Seconds(), service, method, code)
+}
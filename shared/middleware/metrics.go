@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pz1.2/shared/metrics"
+)
+
+var (
+	httpRequestsTotal = metrics.NewCounterVec("http_requests_total",
+		"HTTP requests by method, route pattern and status.", "method", "route", "status")
+	httpRequestDuration = metrics.NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency by method, route pattern and status.", metrics.DefBuckets, "method", "route", "status")
+)
+
+// Metrics records request counts and latencies for mux. Requests are
+// labelled with the matched route pattern rather than the path, so that
+// /v1/tasks/{id} is a single series.
+func Metrics(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		mux.ServeHTTP(rw, r)
+
+		route := routePattern(mux, r)
+		status := strconv.Itoa(rw.statusCode)
+		httpRequestsTotal.Inc(r.Method, route, status)
+		httpRequestDuration.Observe(time.Since(start).Seconds(), r.Method, route, status)
+	})
+}
+
+// routePattern returns the path of the mux pattern matching r, without the
+// method, or "unmatched".
+func routePattern(mux *http.ServeMux, r *http.Request) string {
+	_, pattern := mux.Handler(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
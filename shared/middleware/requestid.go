@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 type contextKey string
@@ -30,3 +32,61 @@ func GetRequestID(ctx context.Context) string {
 	}
 	return ""
 }
+
+// requestIDMetadataKey is X-Request-ID as gRPC metadata, which is lower-case.
+const requestIDMetadataKey = "x-request-id"
+
+// UnaryServerRequestID takes the request ID from the "x-request-id"
+// metadata, or generates one, stores it in the context and sends it back in
+// the response header.
+func UnaryServerRequestID() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		requestID := incomingRequestID(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, requestID))
+		return handler(context.WithValue(ctx, RequestIDKey, requestID), req)
+	}
+}
+
+// StreamServerRequestID is UnaryServerRequestID for streaming methods.
+func StreamServerRequestID() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		requestID := incomingRequestID(ss.Context())
+		ss.SetHeader(metadata.Pairs(requestIDMetadataKey, requestID))
+		ctx := context.WithValue(ss.Context(), RequestIDKey, requestID)
+		return handler(srv, WrapServerStream(ctx, ss))
+	}
+}
+
+// UnaryClientRequestID sends the request ID from the context in the
+// "x-request-id" metadata.
+func UnaryClientRequestID() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingRequestID(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientRequestID is UnaryClientRequestID for streaming methods.
+func StreamClientRequestID() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingRequestID(ctx), desc, cc, method, opts...)
+	}
+}
+
+func incomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if requestID := firstValue(md, requestIDMetadataKey); requestID != "" {
+		return requestID
+	}
+	return uuid.New().String()
+}
+
+func outgoingRequestID(ctx context.Context) context.Context {
+	requestID := GetRequestID(ctx)
+	if requestID == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(requestIDMetadataKey)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, requestIDMetadataKey, requestID)
+}
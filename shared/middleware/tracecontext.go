@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+
+	flagSampled = 0x01
+	// maxTracestateMembers is the limit set by the W3C Trace Context spec.
+	maxTracestateMembers = 32
+)
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceContext is the W3C Trace Context of a span: the trace it belongs to,
+// its own ID and the vendor-specific tracestate passed along unchanged.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	State   string
+}
+
+// ParseTraceparent parses a traceparent header value,
+// 00-<32 hex trace-id>-<16 hex parent-id>-<2 hex flags>. Versions above 00
+// are read the same way, ignoring any fields they add.
+func ParseTraceparent(value string) (TraceContext, error) {
+	var tc TraceContext
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return tc, errInvalidTraceparent
+	}
+	version := value[:2]
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(value) != 55) || (len(value) > 55 && value[55] != '-') {
+		return tc, errInvalidTraceparent
+	}
+
+	traceID, spanID, flags := value[3:35], value[36:52], value[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return tc, errInvalidTraceparent
+	}
+	hex.Decode(tc.TraceID[:], []byte(traceID))
+	hex.Decode(tc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	tc.Flags = f[0]
+
+	if tc.TraceID == ([16]byte{}) || tc.SpanID == ([8]byte{}) {
+		return tc, errInvalidTraceparent
+	}
+	return tc, nil
+}
+
+// ParseTracestate checks a tracestate header value and returns it
+// normalised, or "" if it is malformed and has to be dropped.
+func ParseTracestate(value string) string {
+	var members []string
+	for _, m := range strings.Split(value, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(m, "=")
+		if !ok || key == "" || val == "" || strings.ContainsAny(key, " \t") {
+			return ""
+		}
+		members = append(members, m)
+	}
+	if len(members) > maxTracestateMembers {
+		return ""
+	}
+	return strings.Join(members, ",")
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Traceparent formats tc as a version 00 traceparent header value.
+func (tc TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&flagSampled != 0
+}
+
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// newTraceContext starts a new sampled trace.
+func newTraceContext() TraceContext {
+	tc := TraceContext{Flags: flagSampled}
+	rand.Read(tc.TraceID[:])
+	rand.Read(tc.SpanID[:])
+	return tc
+}
+
+// child returns the context of a new span in the same trace.
+func (tc TraceContext) child() TraceContext {
+	rand.Read(tc.SpanID[:])
+	return tc
+}
+
+type traceContextKey struct{}
+
+func withTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// GetTraceContext returns the trace context of the current span, if any.
+func GetTraceContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// extractTraceContext reads traceparent and tracestate; ok is false if
+// traceparent is missing or malformed.
+func extractTraceContext(traceparent, tracestate string) (TraceContext, bool) {
+	tc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return tc, false
+	}
+	tc.State = ParseTracestate(tracestate)
+	return tc, true
+}
+
+// InjectHTTP sets traceparent and tracestate on an outgoing request.
+func InjectHTTP(ctx context.Context, h http.Header) {
+	tc, ok := GetTraceContext(ctx)
+	if !ok {
+		return
+	}
+	h.Set(TraceparentHeader, tc.Traceparent())
+	if tc.State != "" {
+		h.Set(TracestateHeader, tc.State)
+	}
+}
+
+// injectGRPC adds traceparent and tracestate to the outgoing metadata.
+func injectGRPC(ctx context.Context) context.Context {
+	tc, ok := GetTraceContext(ctx)
+	if !ok {
+		return ctx
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, TraceparentHeader, tc.Traceparent())
+	if tc.State != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, TracestateHeader, tc.State)
+	}
+	return ctx
+}
+
+func extractGRPC(ctx context.Context) (TraceContext, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return extractTraceContext(firstValue(md, TraceparentHeader), strings.Join(md.Get(TracestateHeader), ","))
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type SpanKind int
+
+// Values match the OTLP span kinds.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// Span is one timed operation of a trace. Spans are exported when they end,
+// if the trace is sampled and an exporter is set.
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]any
+	Error        bool
+	StatusText   string
+
+	sampled bool
+	mu      sync.Mutex
+	ended   bool
+}
+
+type exporterHolder struct{ exporter SpanExporter }
+
+var spanExporter atomic.Pointer[exporterHolder]
+
+// SetSpanExporter sets where ended spans go; nil stops recording them.
+// Trace context is propagated either way.
+func SetSpanExporter(e SpanExporter) {
+	spanExporter.Store(&exporterHolder{exporter: e})
+}
+
+// StartSpan starts a span as a child of the span in ctx, or as the root of a
+// new trace, and returns a context carrying it.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent, ok := GetTraceContext(ctx)
+	return startSpan(ctx, name, kind, parent, ok)
+}
+
+func startSpan(ctx context.Context, name string, kind SpanKind, parent TraceContext, hasParent bool) (context.Context, *Span) {
+	tc := newTraceContext()
+	if hasParent {
+		tc = parent.child()
+	}
+
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		TraceID:    tc.TraceIDString(),
+		SpanID:     tc.SpanIDString(),
+		Start:      time.Now(),
+		Attributes: make(map[string]any),
+		sampled:    tc.Sampled(),
+	}
+	if hasParent {
+		span.ParentSpanID = parent.SpanIDString()
+	}
+	if requestID := GetRequestID(ctx); requestID != "" {
+		span.Attributes["request_id"] = requestID
+	}
+	return withTraceContext(ctx, tc), span
+}
+
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(text string) {
+	s.mu.Lock()
+	s.Error = true
+	s.StatusText = text
+	s.mu.Unlock()
+}
+
+// Finish ends the span and hands it to the exporter. Calls after the first
+// are ignored.
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if h := spanExporter.Load(); h != nil && h.exporter != nil && s.sampled {
+		h.exporter.ExportSpan(s)
+	}
+}
+
+// Tracing starts a server span for every request, continuing the trace from
+// the traceparent header when there is a valid one. mux is only used to
+// name spans after the matched route pattern.
+func Tracing(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, ok := extractTraceContext(r.Header.Get(TraceparentHeader), strings.Join(r.Header.Values(TracestateHeader), ","))
+
+		route := routePattern(mux, r)
+		ctx, span := startSpan(r.Context(), r.Method+" "+route, SpanKindServer, parent, ok)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		defer span.Finish()
+
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", rw.statusCode)
+		if rw.statusCode >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(rw.statusCode))
+		}
+	})
+}
+
+// TraceHTTPClient starts a client span for an outgoing request and sets its
+// trace headers. The caller finishes the span with FinishHTTPClient.
+func TraceHTTPClient(req *http.Request, name string) (*http.Request, *Span) {
+	ctx, span := StartSpan(req.Context(), name, SpanKindClient)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+	req = req.WithContext(ctx)
+	InjectHTTP(ctx, req.Header)
+	return req, span
+}
+
+// FinishHTTPClient records the result of a request traced with
+// TraceHTTPClient and ends its span.
+func FinishHTTPClient(span *Span, resp *http.Response, err error) {
+	switch {
+	case err != nil:
+		span.SetError(err.Error())
+	default:
+		span.SetAttribute("http.status_code", resp.StatusCode)
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.SetError(http.StatusText(resp.StatusCode))
+		}
+	}
+	span.Finish()
+}
+
+// UnaryServerTracing continues the trace from the incoming metadata.
+func UnaryServerTracing() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		finishServerSpan(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerTracing continues the trace from the incoming metadata for
+// streaming RPCs.
+func StreamServerTracing() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startServerSpan(ss.Context(), info.FullMethod)
+		err := handler(srv, WrapServerStream(ctx, ss))
+		finishServerSpan(span, err)
+		return err
+	}
+}
+
+// UnaryClientTracing starts a client span for each call and sends its trace
+// context in the metadata.
+func UnaryClientTracing() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := StartSpan(ctx, strings.TrimPrefix(method, "/"), SpanKindClient)
+		span.SetAttribute("rpc.system", "grpc")
+		span.SetAttribute("rpc.method", method)
+
+		err := invoker(injectGRPC(ctx), method, req, reply, cc, opts...)
+
+		span.SetAttribute("rpc.grpc.status_code", status.Code(err).String())
+		if err != nil {
+			span.SetError(status.Convert(err).Message())
+		}
+		span.Finish()
+		return err
+	}
+}
+
+func startServerSpan(ctx context.Context, fullMethod string) (context.Context, *Span) {
+	parent, ok := extractGRPC(ctx)
+	ctx, span := startSpan(ctx, strings.TrimPrefix(fullMethod, "/"), SpanKindServer, parent, ok)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", fullMethod)
+	return ctx, span
+}
+
+func finishServerSpan(span *Span, err error) {
+	code := status.Code(err)
+	span.SetAttribute("rpc.grpc.status_code", code.String())
+	// Client mistakes such as Unauthenticated are not server failures.
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		span.SetError(status.Convert(err).Message())
+	}
+	span.Finish()
+}
+
+// WrapServerStream returns ss with its context replaced by ctx, for stream
+// interceptors that add values to the context.
+func WrapServerStream(ctx context.Context, ss grpc.ServerStream) grpc.ServerStream {
+	return &contextStream{ServerStream: ss, ctx: ctx}
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,73 @@
+// Package problem renders HTTP errors as RFC 7807 problem details.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pz1.2/shared/middleware"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem types beyond the plain HTTP status. Clients may match on them.
+const (
+	TypeBlank              = "about:blank"
+	TypeValidation         = "/problems/validation-error"
+	TypeInvalidToken       = "/problems/invalid-token"
+	TypeInsufficientScope  = "/problems/insufficient-scope"
+	TypePreconditionFailed = "/problems/precondition-failed"
+	TypeIdempotencyKey     = "/problems/idempotency-key"
+)
+
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// New returns a problem whose title is the standard text for status.
+func New(status int, detail string) *Problem {
+	return &Problem{
+		Type:   TypeBlank,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Validation returns a 400 problem listing what is wrong with each field.
+func Validation(errs map[string]string) *Problem {
+	p := New(http.StatusBadRequest, "validation failed")
+	p.Type = TypeValidation
+	p.Errors = errs
+	return p
+}
+
+func (p *Problem) WithType(problemType string) *Problem {
+	p.Type = problemType
+	return p
+}
+
+// Write sends p, filling in the instance and request ID from r.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = middleware.GetRequestID(r.Context())
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error is a shorthand for Write(w, r, New(status, detail)).
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}